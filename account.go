@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/slicken/arbitrager/balance"
+)
+
+// runBalance lists exchange balances
+func runBalance(args []string) {
+	fs := newFlagSet("balance")
+	if err := fs.parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, "balance:", err)
+		os.Exit(2)
+	}
+
+	connect()
+	var err error
+	if tickers, err = E.GetAllTickers(); err != nil {
+		fmt.Println("could not get tickers:", err)
+		os.Exit(1)
+	}
+
+	var list []*balance.Balance
+	for _, b := range balance.Balances {
+		if b.Free+b.Locked > 0 {
+			list = append(list, b)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Asset < list[j].Asset
+	})
+
+	var total float64
+	fmt.Printf("%-8s %18s %18s %14s\n", "asset", "free", "locked", "USD")
+	for _, b := range list {
+		usd := usdValue(b.Asset, b.Free+b.Locked)
+		total += usd
+		fmt.Printf("%-8s %18f %18f %14.2f\n", b.Asset, b.Free, b.Locked, usd)
+	}
+	fmt.Printf("%-8s %18s %18s %14.2f\n", "total", "", "", total)
+}
+
+// runOrders lists open orders on the exchange
+func runOrders(args []string) {
+	fs := newFlagSet("orders")
+	if err := fs.parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, "orders:", err)
+		os.Exit(2)
+	}
+
+	connect()
+	list, err := E.GetOpenOrders()
+	if err != nil {
+		fmt.Println("could not get open orders:", err)
+		os.Exit(1)
+	}
+	if len(list) == 0 {
+		fmt.Println("no open orders")
+		return
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Time.Before(list[j].Time)
+	})
+
+	fmt.Printf("%-12s %-19s %-12s %-5s %16s %16s %16s %16s\n", "id", "time", "pair", "side", "amount", "filled", "price", "stop")
+	for _, o := range list {
+		fmt.Printf("%-12d %-19s %-12s %-5s %16f %16f %16f %16f\n",
+			o.ID, o.Time.Format("2006-01-02 15:04:05"), o.Pair, o.Side, o.Amount, o.Filled, o.Price, o.Stop)
+	}
+}
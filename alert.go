@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/slicken/arbitrager/alert"
+	"github.com/slicken/arbitrager/config"
+	"github.com/slicken/arbitrager/journal"
+	"github.com/slicken/arbitrager/risk"
+)
+
+// openAlerts starts alert sinks and feeds them risk trips and journal entries
+func openAlerts(ctx context.Context) {
+	alert.Open(config.Cfg.Alerts, config.Cfg.Email)
+	risk.OnTrip = func(t *risk.Trip) {
+		alert.Send(alert.Risk, "risk: "+t.Limit, "%s tripped: %s\nhalted: %v", t.Limit, t.Reason, t.Halt)
+	}
+	journal.OnAdd = alertEntry
+	go watchStreams(ctx)
+}
+
+// alertEntry alerts a journal entry. results are trade or failed events
+func alertEntry(e journal.Entry) {
+	name := e.Asset
+	for i, p := range e.Pairs {
+		if i < len(e.Sides) {
+			name += " " + e.Sides[i] + " " + p
+		}
+	}
+	// books are too large for an alert
+	e.Books = nil
+	ev := alert.Event{Time: e.Time, Data: e}
+	switch e.Type {
+	case journal.Result:
+		if e.Error != "" {
+			ev.Kind = alert.Failed
+			ev.Subject = "route failed: " + name
+			ev.Body = fmt.Sprintf("route %s with %f %s failed: %s", e.Route, e.Initial, e.Asset, e.Error)
+		} else {
+			ev.Kind = alert.Trade
+			ev.Subject = fmt.Sprintf("%s %f (%.2f%%)", e.Asset, e.PnL, e.PnLPerc)
+			ev.Body = fmt.Sprintf("route %s %s\ninitial %f, pnl %f %s, %.2f USD", e.Route, name, e.Initial, e.PnL, e.Asset, e.PnLUSD)
+		}
+	case journal.Opportunity:
+		ev.Kind = alert.Opportunity
+		ev.Subject = fmt.Sprintf("%.2f%% %s", e.Perc, name)
+		ev.Body = fmt.Sprintf("route %s %s\ninitial %f, profit %f, prices %v", e.Route, name, e.Initial, e.Profit, e.Prices)
+	case journal.Decision:
+		ev.Kind = alert.Decision
+		ev.Subject = e.Decision + " " + name
+		ev.Body = fmt.Sprintf("route %s %s: %s", e.Route, e.Decision, e.Reason)
+		if e.Details != "" {
+			ev.Body += ", " + e.Details
+		}
+	case journal.Order:
+		ev.Kind = alert.Order
+		result := "ok"
+		if e.Error != "" {
+			result = e.Error
+		}
+		if e.Request != nil {
+			ev.Subject = fmt.Sprintf("leg %d %s %s %s", e.Leg, e.Request.Side, e.Request.Pair, result)
+		} else {
+			ev.Subject = fmt.Sprintf("leg %d %s", e.Leg, result)
+		}
+		ev.Body = fmt.Sprintf("route %s leg %d in %v: %s", e.Route, e.Leg, e.Latency, result)
+	default:
+		return
+	}
+	alert.Post(ev)
+}
+
+// watchStreams alerts streams down longer than OutageSeconds, and when they are back
+func watchStreams(ctx context.Context) {
+	outage := time.Duration(config.Cfg.Alerts.OutageSeconds) * time.Second
+	if outage <= 0 {
+		outage = time.Minute
+	}
+	t := time.NewTicker(10 * time.Second)
+	defer t.Stop()
+	down := make(map[string]time.Time)
+	alerted := make(map[string]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		for _, c := range E.Conns() {
+			if ok, _ := c.Connected(); ok {
+				if alerted[c.Name] {
+					alert.Send(alert.Outage, c.Name+" is back", "%s reconnected after %v", c.Name, time.Since(down[c.Name]).Round(time.Second))
+				}
+				delete(down, c.Name)
+				delete(alerted, c.Name)
+				continue
+			}
+			if _, ok := down[c.Name]; !ok {
+				down[c.Name] = time.Now()
+			}
+			if !alerted[c.Name] && time.Since(down[c.Name]) >= outage {
+				alerted[c.Name] = true
+				alert.Send(alert.Outage, c.Name+" is down", "%s down for %v, %d reconnects so far", c.Name, time.Since(down[c.Name]).Round(time.Second), c.Reconnects())
+			}
+		}
+	}
+}
+
+// runAlert sends a test alert to every sink
+func runAlert(args []string) {
+	fs := newFlagSet("alert")
+	if err := fs.parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, "alert:", err)
+		os.Exit(2)
+	}
+	if err := config.ReadConfig(); err != nil {
+		fmt.Println("could not load config file:", err)
+		os.Exit(1)
+	}
+	results, err := alert.Test(config.Cfg.Alerts, config.Cfg.Email)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	var names []string
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	code := 0
+	for _, name := range names {
+		if err := results[name]; err != nil {
+			fmt.Printf("%-10s failed: %v\n", name, err)
+			code = 1
+			continue
+		}
+		fmt.Printf("%-10s sent\n", name)
+	}
+	os.Exit(code)
+}
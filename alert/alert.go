@@ -0,0 +1,361 @@
+package alert
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slicken/arbitrager/config"
+)
+
+// event kinds
+const (
+	Trade  = "trade"
+	Failed = "failed"
+	Risk   = "risk"
+	Start  = "start"
+	Stop   = "stop"
+	Outage = "outage"
+	// journal entries, only sent if routed by kind
+	Opportunity = "opportunity"
+	Decision    = "decision"
+	Order       = "order"
+)
+
+// urgent kinds are sent at once, others wait for the next digest of a sink
+var urgent = map[string]bool{
+	Failed: true,
+	Risk:   true,
+	Stop:   true,
+	Outage: true,
+}
+
+// defaults are the kinds routed by "*"
+var defaults = map[string]bool{
+	Trade:  true,
+	Failed: true,
+	Risk:   true,
+	Start:  true,
+	Stop:   true,
+	Outage: true,
+}
+
+// maxQueue is the most events a sink keeps while it can not send
+const maxQueue = 1000
+
+// Event is something worth an alert
+type Event struct {
+	Time    time.Time   `json:"time"`
+	Kind    string      `json:"kind"`
+	Subject string      `json:"subject"`
+	Body    string      `json:"body"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Sink sends events somewhere. a Sink that sends events one by one returns
+// a *partialError when it fails after some, so they are not sent again
+type Sink interface {
+	Name() string
+	Send(list []Event) error
+}
+
+// partialError is returned by Sink.Send when the first sent events went out
+type partialError struct {
+	sent int
+	err  error
+}
+
+func (e *partialError) Error() string {
+	return e.err.Error()
+}
+
+func (e *partialError) Unwrap() error {
+	return e.err
+}
+
+// sink is a Sink with its queue, digest and rate limit
+type sink struct {
+	Sink
+	digest     time.Duration
+	maxPerHour int
+	queue      []Event
+	last       time.Time
+	// sent holds the times of sends within the last hour
+	sent []time.Time
+}
+
+var (
+	mu      sync.Mutex
+	sinks   []*sink
+	routes  map[string][]string
+	retries int
+	wake    chan bool
+	quit    chan bool
+	done    chan bool
+)
+
+// newSinks returns the sinks enabled in config
+func newSinks(c config.AlertsConfig, email config.EmailConfig) []*sink {
+	var list []*sink
+	if email.SMTP != "" {
+		list = append(list, newSink(&emailSink{email}, email.DigestMinutes, email.MaxPerHour, 15, 10))
+	}
+	if c.Webhook.URL != "" {
+		list = append(list, newSink(newWebhook(c.Webhook), c.Webhook.DigestMinutes, c.Webhook.MaxPerHour, 0, 0))
+	}
+	if c.Telegram.Token != "" {
+		list = append(list, newSink(&telegramSink{c.Telegram}, c.Telegram.DigestMinutes, c.Telegram.MaxPerHour, 0, 0))
+	}
+	if c.Slack.URL != "" {
+		list = append(list, newSink(&slackSink{c.Slack}, c.Slack.DigestMinutes, c.Slack.MaxPerHour, 0, 0))
+	}
+	return list
+}
+
+func newSink(s Sink, digest, maxPerHour, defDigest, defMax int) *sink {
+	if digest <= 0 {
+		digest = defDigest
+	}
+	if maxPerHour <= 0 {
+		maxPerHour = defMax
+	}
+	return &sink{Sink: s, digest: time.Duration(digest) * time.Minute, maxPerHour: maxPerHour, last: time.Now()}
+}
+
+// Open starts sending alerts to the sinks enabled in config
+func Open(c config.AlertsConfig, email config.EmailConfig) {
+	list := newSinks(c, email)
+	if len(list) == 0 {
+		return
+	}
+	names := make(map[string]bool)
+	for _, s := range list {
+		names[s.Name()] = true
+	}
+	for kind, to := range c.Routes {
+		for _, name := range to {
+			if !names[name] {
+				log.Printf("alert route %q: sink %q is not enabled\n", kind, name)
+			}
+		}
+	}
+
+	mu.Lock()
+	sinks = list
+	routes = c.Routes
+	retries = c.Retries
+	mu.Unlock()
+
+	wake = make(chan bool, 1)
+	quit = make(chan bool)
+	done = make(chan bool)
+	go func() {
+		defer close(done)
+		t := time.NewTicker(10 * time.Second)
+		defer t.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-wake:
+				flush(false)
+			case <-t.C:
+				flush(false)
+			}
+		}
+	}()
+	for _, s := range list {
+		log.Printf("alerts to %s, digest %v, at most %d per hour (0=unlimited)\n", s.Name(), s.digest, s.maxPerHour)
+	}
+}
+
+// Close stops sending and sends queued events regardless of digests and rate limits
+func Close() {
+	if quit == nil {
+		return
+	}
+	close(quit)
+	<-done
+	quit = nil
+	flush(true)
+}
+
+// Send queues an event of kind to the sinks routed for it
+func Send(kind, subject, format string, a ...interface{}) {
+	Post(Event{Kind: kind, Subject: subject, Body: fmt.Sprintf(format, a...)})
+}
+
+// Post queues e to the sinks routed for its kind
+func Post(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	mu.Lock()
+	queued := false
+	for _, s := range sinks {
+		if !routed(e.Kind, s.Name()) {
+			continue
+		}
+		s.queue = append(s.queue, e)
+		if len(s.queue) > maxQueue {
+			s.queue = s.queue[len(s.queue)-maxQueue:]
+		}
+		queued = true
+	}
+	mu.Unlock()
+
+	if queued {
+		select {
+		case wake <- true:
+		default:
+		}
+	}
+}
+
+// routed returns true if kind is sent to sink name. must be called with mu locked
+func routed(kind, name string) bool {
+	to, ok := routes[kind]
+	if !ok {
+		if !defaults[kind] {
+			return false
+		}
+		if to, ok = routes["*"]; !ok {
+			// no routes sends the default kinds everywhere
+			return true
+		}
+	}
+	for _, n := range to {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// flush sends the queue of every sink that is due and within its rate limit
+func flush(force bool) {
+	mu.Lock()
+	type batch struct {
+		s    *sink
+		list []Event
+	}
+	var batches []batch
+	now := time.Now()
+	for _, s := range sinks {
+		if len(s.queue) == 0 || !force && !s.due(now) {
+			continue
+		}
+		batches = append(batches, batch{s, s.queue})
+		s.queue = nil
+		s.last = now
+	}
+	n := retries
+	mu.Unlock()
+
+	for _, b := range batches {
+		left, err := send(b.s, b.list, n)
+		mu.Lock()
+		if len(left) < len(b.list) {
+			// only sends count against the rate limit
+			b.s.sent = append(b.s.sent, now)
+		}
+		if err != nil {
+			log.Printf("could not send alerts to %s: %v\n", b.s.Name(), err)
+			// keep events not sent for the next flush
+			b.s.queue = append(left, b.s.queue...)
+			if len(b.s.queue) > maxQueue {
+				b.s.queue = b.s.queue[len(b.s.queue)-maxQueue:]
+			}
+		}
+		mu.Unlock()
+	}
+}
+
+// due returns true if the queue of s may be sent. must be called with mu locked
+func (s *sink) due(now time.Time) bool {
+	var recent []time.Time
+	for _, t := range s.sent {
+		if now.Sub(t) < time.Hour {
+			recent = append(recent, t)
+		}
+	}
+	s.sent = recent
+	if s.maxPerHour > 0 && len(s.sent) >= s.maxPerHour {
+		return false
+	}
+	if now.Sub(s.last) >= s.digest {
+		return true
+	}
+	for _, e := range s.queue {
+		if urgent[e.Kind] {
+			return true
+		}
+	}
+	return false
+}
+
+// send sends list to s, retrying with backoff. it returns the events not sent
+func send(s Sink, list []Event, retries int) ([]Event, error) {
+	delay := time.Second
+	var err error
+	for i := 0; i <= retries; i++ {
+		if i > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		if err = s.Send(list); err == nil {
+			return nil, nil
+		}
+		var p *partialError
+		if errors.As(err, &p) {
+			list = list[p.sent:]
+		}
+	}
+	return list, err
+}
+
+// digest returns subject and body of a message with all events
+func digest(list []Event) (string, string) {
+	if len(list) == 1 {
+		e := list[0]
+		return e.Subject, e.Time.Format("2006-01-02 15:04:05") + "\n\n" + e.Body + "\n"
+	}
+	counts := make(map[string]int)
+	var kinds []string
+	for _, e := range list {
+		if counts[e.Kind] == 0 {
+			kinds = append(kinds, e.Kind)
+		}
+		counts[e.Kind]++
+	}
+	var parts []string
+	for _, k := range kinds {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[k], k))
+	}
+	var b bytes.Buffer
+	for _, e := range list {
+		fmt.Fprintf(&b, "%s  %-7s %s\n", e.Time.Format("2006-01-02 15:04:05"), e.Kind, e.Subject)
+		if e.Body != "" {
+			fmt.Fprintf(&b, "    %s\n", strings.Replace(strings.TrimSpace(e.Body), "\n", "\n    ", -1))
+		}
+	}
+	return "digest: " + strings.Join(parts, ", "), b.String()
+}
+
+// Test sends a test event to every enabled sink at once and returns their errors
+func Test(c config.AlertsConfig, email config.EmailConfig) (map[string]error, error) {
+	list := newSinks(c, email)
+	if len(list) == 0 {
+		return nil, errors.New("no alert sinks in config")
+	}
+	e := []Event{{Time: time.Now(), Kind: "test", Subject: "test", Body: "alerts are working"}}
+	results := make(map[string]error)
+	for _, s := range list {
+		_, results[s.Name()] = send(s, e, c.Retries)
+	}
+	return results, nil
+}
@@ -0,0 +1,68 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/slicken/arbitrager/config"
+)
+
+// telegramAPI is the bot api url, %s is the bot token
+const telegramAPI = "https://api.telegram.org/bot%s/sendMessage"
+
+// telegramMax is the longest message telegram accepts
+const telegramMax = 4096
+
+// telegramSink sends events as one message from a telegram bot
+type telegramSink struct {
+	c config.TelegramConfig
+}
+
+func (s *telegramSink) Name() string {
+	return "telegram"
+}
+
+func (s *telegramSink) Send(list []Event) error {
+	b, err := json.Marshal(map[string]string{"chat_id": s.c.ChatID, "text": truncate(message(list), telegramMax)})
+	if err != nil {
+		return err
+	}
+	return post(fmt.Sprintf(telegramAPI, s.c.Token), nil, b)
+}
+
+// truncate cuts text to max bytes with "..." at the end,
+// on a rune boundary so it stays valid utf-8
+func truncate(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	n := max - 3
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n] + "..."
+}
+
+// slackSink sends events as one message to a slack compatible incoming webhook
+type slackSink struct {
+	c config.SlackConfig
+}
+
+func (s *slackSink) Name() string {
+	return "slack"
+}
+
+func (s *slackSink) Send(list []Event) error {
+	b, err := json.Marshal(map[string]string{"text": message(list)})
+	if err != nil {
+		return err
+	}
+	return post(s.c.URL, nil, b)
+}
+
+// message returns the digest of list as chat text
+func message(list []Event) string {
+	subject, body := digest(list)
+	return "[arbitrager] " + subject + "\n" + body
+}
@@ -0,0 +1,39 @@
+package alert
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		max  int
+		want string
+	}{
+		{"short", "route failed", 20, "route failed"},
+		{"exact", "route failed", 12, "route failed"},
+		{"ascii", "route failed", 10, "route f..."},
+		{"before a rune", "route €100", 9, "route ..."},
+		{"inside a rune", "route €100", 10, "route ..."},
+		{"after a rune", "route €1000", 12, "route €..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncate(tt.text, tt.max)
+			if got != tt.want {
+				t.Errorf("truncate(%q, %d) = %q, want %q", tt.text, tt.max, got, tt.want)
+			}
+			if len(got) > tt.max || !utf8.ValidString(got) {
+				t.Errorf("truncate(%q, %d) = %q, %d bytes", tt.text, tt.max, got, len(got))
+			}
+		})
+	}
+
+	long := strings.Repeat("€", telegramMax)
+	if got := truncate(long, telegramMax); len(got) > telegramMax || !utf8.ValidString(got) {
+		t.Errorf("truncated %d bytes to %d, valid %v", len(long), len(got), utf8.ValidString(got))
+	}
+}
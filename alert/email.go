@@ -0,0 +1,52 @@
+package alert
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/slicken/arbitrager/config"
+)
+
+// emailSink sends events as one email over SMTP
+type emailSink struct {
+	c config.EmailConfig
+}
+
+func (s *emailSink) Name() string {
+	return "email"
+}
+
+func (s *emailSink) Send(list []Event) error {
+	subject, body := digest(list)
+	return sendMail(s.c, subject, body)
+}
+
+// recipients returns To, or the sender if none is set
+func recipients(c config.EmailConfig) []string {
+	if len(c.To) > 0 {
+		return c.To
+	}
+	return []string{c.User}
+}
+
+// sendMail sends an email over SMTP. auth is only used when a password is set
+func sendMail(c config.EmailConfig, subject, body string) error {
+	to := recipients(c)
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", c.User)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: [arbitrager] %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+
+	var auth smtp.Auth
+	if c.Pass != "" {
+		auth = smtp.PlainAuth("", c.User, c.Pass, c.SMTP)
+	}
+	return smtp.SendMail(net.JoinHostPort(c.SMTP, c.PORT), auth, c.User, to, msg.Bytes())
+}
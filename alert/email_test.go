@@ -0,0 +1,155 @@
+package alert
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slicken/arbitrager/config"
+)
+
+// mail is what the smtp stand-in received
+type mail struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpServer starts a minimal SMTP server on 127.0.0.1 and returns its
+// host, port and the mails it receives
+func smtpServer(t *testing.T) (string, string, <-chan mail) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	mails := make(chan mail, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, mails)
+		}
+	}()
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	return host, port, mails
+}
+
+func serveSMTP(conn net.Conn, mails chan<- mail) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ready")
+	var m mail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			tp.PrintfLine("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			m = mail{from: strings.Trim(line[len("MAIL FROM:"):], "<> ")}
+			tp.PrintfLine("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			m.to = append(m.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			tp.PrintfLine("250 ok")
+		case cmd == "DATA":
+			tp.PrintfLine("354 go ahead")
+			b, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			m.data = string(b)
+			mails <- m
+			tp.PrintfLine("250 queued")
+		case cmd == "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("250 ok")
+		}
+	}
+}
+
+// header returns the value of header name in data
+func header(data, name string) string {
+	r := textproto.NewReader(bufio.NewReader(strings.NewReader(data)))
+	h, _ := r.ReadMIMEHeader()
+	return h.Get(name)
+}
+
+func TestEmailSink(t *testing.T) {
+	host, port, mails := smtpServer(t)
+	c := config.EmailConfig{User: "bot@example.com", SMTP: host, PORT: port, To: []string{"a@example.com", "b@example.com"}}
+	at := time.Date(2021, 8, 10, 13, 25, 28, 0, time.UTC)
+	trade := Event{Time: at, Kind: Trade, Subject: "USDT 0.957808 (0.96%)", Body: "route arb-1 USDT buy PSGUSDT"}
+	failed := Event{Time: at, Kind: Failed, Subject: "route failed: USDT buy BTCUSDT", Body: "leg 1: timeout"}
+
+	tests := []struct {
+		name    string
+		events  []Event
+		subject string
+		body    []string
+	}{
+		{
+			name:    "trade",
+			events:  []Event{trade},
+			subject: "[arbitrager] USDT 0.957808 (0.96%)",
+			body:    []string{"2021-08-10 13:25:28", "route arb-1 USDT buy PSGUSDT"},
+		},
+		{
+			name:    "digest",
+			events:  []Event{trade, failed},
+			subject: "[arbitrager] digest: 1 trade, 1 failed",
+			body: []string{
+				"2021-08-10 13:25:28  trade   USDT 0.957808 (0.96%)",
+				"    route arb-1 USDT buy PSGUSDT",
+				"2021-08-10 13:25:28  failed  route failed: USDT buy BTCUSDT",
+				"    leg 1: timeout",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &emailSink{c}
+			if err := s.Send(tt.events); err != nil {
+				t.Fatal(err)
+			}
+			var m mail
+			select {
+			case m = <-mails:
+			case <-time.After(2 * time.Second):
+				t.Fatal("no mail received")
+			}
+			if m.from != c.User {
+				t.Errorf("MAIL FROM %q, want %q", m.from, c.User)
+			}
+			if strings.Join(m.to, ",") != strings.Join(c.To, ",") {
+				t.Errorf("RCPT TO %v, want %v", m.to, c.To)
+			}
+			if got := header(m.data, "To"); got != "a@example.com, b@example.com" {
+				t.Errorf("To header %q", got)
+			}
+			if got := header(m.data, "Subject"); got != tt.subject {
+				t.Errorf("Subject %q, want %q", got, tt.subject)
+			}
+			i := strings.Index(m.data, "\n\n")
+			if i < 0 {
+				t.Fatalf("no body in %q", m.data)
+			}
+			body := m.data[i+2:]
+			for _, want := range tt.body {
+				if !strings.Contains(body, want+"\n") {
+					t.Errorf("body %q does not have line %q", body, want)
+				}
+			}
+		})
+	}
+}
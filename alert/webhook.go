@@ -0,0 +1,95 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+
+	"github.com/slicken/arbitrager/config"
+)
+
+// httpClient posts to webhooks and chat apis
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// webhookSink posts every event as json, rendered by an optional template
+type webhookSink struct {
+	c    config.WebhookConfig
+	tmpl *template.Template
+	err  error
+}
+
+func newWebhook(c config.WebhookConfig) *webhookSink {
+	s := &webhookSink{c: c}
+	if c.Template != "" {
+		s.tmpl, s.err = template.New("webhook").Funcs(template.FuncMap{
+			"json": func(v interface{}) (string, error) {
+				b, err := json.Marshal(v)
+				return string(b), err
+			},
+		}).Parse(c.Template)
+	}
+	return s
+}
+
+func (s *webhookSink) Name() string {
+	return "webhook"
+}
+
+func (s *webhookSink) Send(list []Event) error {
+	if s.err != nil {
+		return fmt.Errorf("template: %v", s.err)
+	}
+	for i, e := range list {
+		var b bytes.Buffer
+		var err error
+		if s.tmpl != nil {
+			if err = s.tmpl.Execute(&b, e); err != nil {
+				err = fmt.Errorf("template: %v", err)
+			}
+		} else {
+			err = json.NewEncoder(&b).Encode(e)
+		}
+		if err == nil {
+			err = post(s.c.URL, s.c.Headers, b.Bytes())
+		}
+		if err != nil {
+			if i > 0 {
+				return &partialError{sent: i, err: err}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// post posts a json body to to and fails on error status codes.
+// errors never hold the url, it may contain a token
+func post(to string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, to, bytes.NewReader(body))
+	if err != nil {
+		return errors.New("invalid url")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		if ue, ok := err.(*url.Error); ok {
+			return fmt.Errorf("%s: %v", ue.Op, ue.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package alert
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/slicken/arbitrager/config"
+)
+
+func TestWebhookRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		fail    map[int]bool // requests answered with 500, counted from 0
+		retries int
+		want    []string
+		left    []string
+	}{
+		{
+			name: "all sent",
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name:    "resumes after the failed event",
+			fail:    map[int]bool{1: true},
+			retries: 1,
+			want:    []string{"a", "b", "c"},
+		},
+		{
+			name: "keeps events not sent",
+			fail: map[int]bool{2: true},
+			want: []string{"a", "b"},
+			left: []string{"c"},
+		},
+		{
+			name: "keeps all if the first fails",
+			fail: map[int]bool{0: true},
+			left: []string{"a", "b", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var got []string
+			n := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				fail := tt.fail[n]
+				n++
+				if fail {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				var e Event
+				json.NewDecoder(r.Body).Decode(&e)
+				got = append(got, e.Subject)
+			}))
+			defer srv.Close()
+
+			var list []Event
+			for _, s := range []string{"a", "b", "c"} {
+				list = append(list, Event{Kind: Trade, Subject: s})
+			}
+			left, err := send(newWebhook(config.WebhookConfig{URL: srv.URL}), list, tt.retries)
+			if (err != nil) != (len(tt.left) > 0) {
+				t.Errorf("send error %v with %d left", err, len(tt.left))
+			}
+			var subjects []string
+			for _, e := range left {
+				subjects = append(subjects, e.Subject)
+			}
+			if strings.Join(subjects, ",") != strings.Join(tt.left, ",") {
+				t.Errorf("left %v, want %v", subjects, tt.left)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("posted %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
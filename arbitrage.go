@@ -4,10 +4,15 @@ import (
 	"fmt"
 	"log"
 	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/slicken/arbitrager/currencie"
+	"github.com/slicken/arbitrager/episodes"
 	"github.com/slicken/arbitrager/exchanges"
+	"github.com/slicken/arbitrager/logger"
 	"github.com/slicken/arbitrager/orderbook"
 )
 
@@ -38,6 +43,15 @@ type Set struct {
 
 type Sets []Set
 
+// Name returns a readable name of the route, eg. "USDT buy BTCUSDT buy ETHBTC sell ETHUSDT"
+func (s Set) Name() string {
+	name := s.asset
+	for i, p := range s.pair {
+		name += " " + Side[s.route[i]] + " " + p.Name
+	}
+	return name
+}
+
 type Arbitrage interface {
 	Sets(string) Sets
 }
@@ -111,6 +125,81 @@ func SetMapList() []string {
 	return ss
 }
 
+// selectPairs returns the pairs to subscribe to, at most limit. only complete
+// triangles are kept, by priority, and sets with a leg left out are removed from SetsMap
+func selectPairs() []string {
+	var sets []Set
+	for _, s := range allSets() {
+		if !s.excepted() {
+			sets = append(sets, s)
+		}
+	}
+	total := len(sets)
+
+	// most traded, or most often profitable, first
+	volumes, err := E.GetVolumes()
+	if err != nil {
+		log.Println("could not get volumes:", err.Error())
+	}
+	counts := make(map[string]int)
+	if priority == "episodes" {
+		list, err := episodes.Read(dataFile(episodesFile), time.Time{}, time.Time{})
+		if err != nil {
+			log.Println("could not read episodes:", err.Error())
+		}
+		for _, e := range list {
+			counts[e.Route]++
+		}
+	}
+	volume := make(map[string]float64)
+	for _, s := range sets {
+		volume[s.Name()] = s.volume(volumes)
+	}
+	sort.SliceStable(sets, func(i, j int) bool {
+		a, b := sets[i].Name(), sets[j].Name()
+		if counts[a] != counts[b] {
+			return counts[a] > counts[b]
+		}
+		return volume[a] > volume[b]
+	})
+
+	selected := make(map[string]bool)
+	var pairs []string
+	SetsMap = make(map[currencie.Pair]Sets)
+	for _, s := range sets {
+		var add []string
+		for _, p := range s.pair {
+			if !selected[p.Name] {
+				add = append(add, p.Name)
+			}
+		}
+		if len(pairs)+len(add) > limit {
+			continue
+		}
+		for _, name := range add {
+			selected[name] = true
+		}
+		pairs = append(pairs, add...)
+		for _, p := range s.pair {
+			SetsMap[p] = append(SetsMap[p], s)
+		}
+	}
+	log.Printf("selected %d of %d routes on %d books\n", len(allSets()), total, len(pairs))
+	return pairs
+}
+
+// excepted returns true if s trades an asset in except
+func (s Set) excepted() bool {
+	for _, e := range except {
+		for _, p := range s.pair {
+			if e == p.Base || e == p.Quote {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (s Sets) List() []string {
 	var ss []string
 	for _, set := range s {
@@ -229,25 +318,37 @@ func mapSets() {
 	}
 }
 
-func containList(str string, list []string) bool {
-	for _, v := range list {
-		if strings.Contains(str, v) {
-			return true
-		}
-	}
-	return false
-}
-
 type OrderSet struct {
+	id      string
 	initial float64
 	profit  float64
 	perc    float64
+	margin  float64 // estimated slippage in percent, added to target
 	amount  [3]float64
 	price   [3]float64
-	msg     string
 	Set
 }
 
+// routeSeq tells apart routes started in the same nanosecond
+var routeSeq uint64
+
+// newRouteID returns a unique id for a route execution
+func newRouteID() string {
+	n := atomic.AddUint64(&routeSeq, 1)
+	return "arb-" + strconv.FormatInt(time.Now().UnixNano(), 36) + strconv.FormatUint(n, 36)
+}
+
+// clientID returns client order id of leg. retries of a leg use the same id
+func (o *OrderSet) clientID(leg int) string {
+	return fmt.Sprintf("%s-%d", o.id, leg)
+}
+
+// fields returns log fields of o
+func (o *OrderSet) fields() []interface{} {
+	return []interface{}{"asset", o.asset, "route", o.Name(), "amount", o.initial, "profit", o.profit, "perc", o.perc,
+		"prices", fmt.Sprintf("%f %f %f", o.price[0], o.price[1], o.price[2])}
+}
+
 // calcStepProfits looks for highest profits with a decreasing amount loop
 func (s Set) calcStepProfits(amount float64) *OrderSet {
 	var os = make([]*OrderSet, 0)
@@ -265,8 +366,8 @@ func (s Set) calcStepProfits(amount float64) *OrderSet {
 		return os[i].profit > os[j].profit
 	})
 
-	log.Printf(os[0].msg, "==>")
 	os[0].Set = s
+	scanLog.Info("opportunity", os[0].fields()...)
 	return os[0]
 }
 
@@ -334,10 +435,9 @@ func (s Set) calcDepthProfitsOld(amount float64) *OrderSet {
 	if 0.1 > o.perc {
 		return nil
 	}
-	o.msg = fmt.Sprintf("%-6s %-12f %%s %-12f (%5.2f%%%%) %8s %-12s %-12f %8s %-12s %-12f %8s %-12s %-12f\n",
-		s.asset, o.initial, o.profit, o.perc, Side[s.route[0]], s.pair[0].Name, o.price[0], Side[s.route[1]], s.pair[1].Name, o.price[1], Side[s.route[2]], s.pair[2].Name, o.price[2])
-	if verbose {
-		log.Printf(o.msg, "   ")
+	if scanLog.Enabled(logger.Debug) {
+		o.Set = s
+		scanLog.Debug("route", o.fields()...)
 	}
 	if target > o.perc {
 		return nil
@@ -349,6 +449,24 @@ func (s Set) calcDepthProfitsOld(amount float64) *OrderSet {
 // calcDepthProfits calculates triangular arbitrage profits
 // using real ask/bid prices from orderbook price depth
 func (s Set) calcDepthProfits(amount float64) *OrderSet {
+	o := s.depthProfits(amount)
+	if o == nil || 0.1 > o.perc {
+		return nil
+	}
+	if scanLog.Enabled(logger.Debug) {
+		scanLog.Debug("route", o.fields()...)
+	}
+	o.margin = s.margin()
+	if target+o.margin > o.perc {
+		return nil
+	}
+
+	return o
+}
+
+// depthProfits returns profits of the route with amount, whatever they are.
+// it returns nil if the books are not deep enough
+func (s Set) depthProfits(amount float64) *OrderSet {
 	o := &OrderSet{
 		initial: amount,
 		amount:  [3]float64{0, 0, 0},
@@ -381,17 +499,6 @@ func (s Set) calcDepthProfits(amount float64) *OrderSet {
 
 	o.profit = next - o.initial
 	o.perc = ((o.initial+o.profit)/o.initial)*100 - 100
-	if 0.1 > o.perc {
-		return nil
-	}
-	o.msg = fmt.Sprintf("%-6s %-12f %%s %-12f (%5.2f%%%%) %8s %-12s %-12f %8s %-12s %-12f %8s %-12s %-12f\n",
-		s.asset, o.initial, o.profit, o.perc, Side[s.route[0]], s.pair[0].Name, o.price[0], Side[s.route[1]], s.pair[1].Name, o.price[1], Side[s.route[2]], s.pair[2].Name, o.price[2])
-	if verbose {
-		log.Printf(o.msg, "   ")
-	}
-	if target > o.perc {
-		return nil
-	}
-
+	o.Set = s
 	return o
 }
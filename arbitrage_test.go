@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/slicken/arbitrager/currencie"
+	"github.com/slicken/arbitrager/exchanges"
+)
+
+// testExchange serves pairs and volumes, other methods are not implemented
+type testExchange struct {
+	exchanges.I
+	pairs   map[string]currencie.Pair
+	volumes map[string]float64
+}
+
+func (e *testExchange) Pair(name string) (currencie.Pair, error) {
+	p, ok := e.pairs[name]
+	if !ok {
+		return p, fmt.Errorf("%s not found", name)
+	}
+	return p, nil
+}
+
+func (e *testExchange) GetVolumes() (map[string]float64, error) {
+	return e.volumes, nil
+}
+
+// pair returns pair base+quote
+func pair(base, quote string) currencie.Pair {
+	return currencie.Pair{Name: base + quote, Enabled: true, Base: base, Quote: quote}
+}
+
+func TestSelectPairs(t *testing.T) {
+	defer func(e exchanges.I, m map[currencie.Pair]Sets, l int, p string, x []string, tk map[string]float64) {
+		E, SetsMap, limit, priority, except, tickers = e, m, l, p, x, tk
+	}(E, SetsMap, limit, priority, except, tickers)
+
+	pairs := make(map[string]currencie.Pair)
+	for _, p := range []currencie.Pair{
+		pair("BTC", "USDT"), pair("ETH", "BTC"), pair("ETH", "USDT"),
+		pair("BNB", "BTC"), pair("BNB", "USDT"),
+		pair("XRP", "USDT"), pair("XRP", "BNB"),
+	} {
+		pairs[p.Name] = p
+	}
+	// by their thinnest leg: eth 500, xrp 400, bnb 300
+	volumes := map[string]float64{
+		"BTCUSDT": 1000, "ETHBTC": 50, "ETHUSDT": 800,
+		"BNBBTC": 30, "BNBUSDT": 600,
+		"XRPUSDT": 900, "XRPBNB": 40,
+	}
+	set := func(r Route, a, b, c string) Set {
+		return Set{asset: "USDT", route: r, pair: [3]currencie.Pair{pairs[a], pairs[b], pairs[c]}}
+	}
+	eth := set(Route{buy, buy, sell}, "BTCUSDT", "ETHBTC", "ETHUSDT")
+	bnb := set(Route{buy, buy, sell}, "BTCUSDT", "BNBBTC", "BNBUSDT")
+	xrp := set(Route{buy, sell, sell}, "XRPUSDT", "XRPBNB", "BNBUSDT")
+
+	tests := []struct {
+		name   string
+		limit  int
+		except []string
+		want   string
+		routes []Set
+	}{
+		{
+			name:   "all",
+			limit:  1024,
+			want:   "BTCUSDT ETHBTC ETHUSDT XRPUSDT XRPBNB BNBUSDT BNBBTC",
+			routes: []Set{eth, bnb, xrp},
+		},
+		{
+			name:   "exact limit",
+			limit:  7,
+			want:   "BTCUSDT ETHBTC ETHUSDT XRPUSDT XRPBNB BNBUSDT BNBBTC",
+			routes: []Set{eth, bnb, xrp},
+		},
+		{
+			name:   "one triangle",
+			limit:  4,
+			want:   "BTCUSDT ETHBTC ETHUSDT",
+			routes: []Set{eth},
+		},
+		{
+			name:   "skips a triangle that does not fit",
+			limit:  5,
+			want:   "BTCUSDT ETHBTC ETHUSDT BNBBTC BNBUSDT",
+			routes: []Set{eth, bnb},
+		},
+		{
+			name:   "excepted asset",
+			limit:  5,
+			except: []string{"ETH"},
+			want:   "XRPUSDT XRPBNB BNBUSDT BTCUSDT BNBBTC",
+			routes: []Set{xrp, bnb},
+		},
+		{
+			name:  "no triangle fits",
+			limit: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			E = &testExchange{pairs: pairs, volumes: volumes}
+			tickers = map[string]float64{"BTCUSDT": 10, "BNBUSDT": 10}
+			limit, priority, except = tt.limit, "volume", tt.except
+			SetsMap = make(map[currencie.Pair]Sets)
+			for _, s := range []Set{eth, bnb, xrp} {
+				for _, p := range s.pair {
+					SetsMap[p] = append(SetsMap[p], s)
+				}
+			}
+
+			if got := strings.Join(selectPairs(), " "); got != tt.want {
+				t.Errorf("pairs %q, want %q", got, tt.want)
+			}
+			var want []string
+			for _, s := range tt.routes {
+				want = append(want, s.Name())
+			}
+			var got []string
+			for _, s := range allSets() {
+				got = append(got, s.Name())
+			}
+			// allSets sorts by name
+			sort.Strings(want)
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("routes %v, want %v", got, want)
+			}
+		})
+	}
+}
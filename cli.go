@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/slicken/arbitrager/config"
+	"github.com/slicken/arbitrager/logger"
+)
+
+// envPrefix is the prefix of environment variables mirroring flags
+const envPrefix = "ARBITRAGER_"
+
+// command is a subcommand of the app
+type command struct {
+	name string
+	args string
+	info string
+	run  func(args []string)
+}
+
+// commands are listed in this order by appInfo. run and scan are started by main
+var commands = []command{
+	{"run", "[flags]", "scan orderbooks and trade opportunities. default if no command is given", nil},
+	{"scan", "[flags]", "scan orderbooks and journal opportunities without trading", nil},
+	{"routes", "[-a <assets>|--all] [-e <assets>] [-l <uint>] [--priority volume|episodes] [--top <n>] [--format text|json|csv]", "list triangles built for assets, the books they need and which are cut by --limit", runRoutes},
+	{"balance", "", "list exchange balances", runBalance},
+	{"orders", "", "list open orders on the exchange", runOrders},
+	{"replay", "[-f <file>] [-from YYYYMMDD] [-to YYYYMMDD] [-t <percent>] [-s <size>] [-n <uint>]", "re-evaluate journaled opportunities with other settings", runReplay},
+	{"backtest", "[-f <file>] [-from YYYYMMDD] [-to YYYYMMDD] [-t <percent>] [-s <size>] [-n <uint>]", "simulate trading journaled opportunities from their books", runBacktest},
+	{"journal", "[-f <file>] [-from YYYYMMDD] [-to YYYYMMDD]", "summarize trade journal", runJournal},
+	{"pnl", "[-f <file>] [-live]", "report realized pnl, -live values stranded assets", runPnl},
+	{"slippage", "[-f <file>]", "report estimated vs executed price per route shape and pair", runSlippage},
+	{"episodes", "[-f <file>] [-from YYYYMMDD] [-to YYYYMMDD] [-top <n>]", "report how long and how often opportunities last", runEpisodes},
+	{"alert", "", "send a test alert to every sink in Email and Alerts of config.json", runAlert},
+}
+
+// findCommand returns command name
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+func appInfo(code int) {
+	fmt.Printf("Usage: ./%s <command> [flags]\n\nCommands\n", appName)
+	for _, c := range commands {
+		fmt.Printf("  %-10s %s\n", c.name, c.info)
+		if c.args != "" {
+			fmt.Printf("  %-10s %s\n", "", c.args)
+		}
+	}
+	fmt.Printf(`
+Run './%s <command> -h' for flags of a command. Flags of run and scan can also
+be set in config.json under "Flags" by their long name, eg. "target": 1.7, or as
+environment variables %sTARGET=1.7. Arguments override environment variables,
+which override the config file.
+`, appName, envPrefix)
+	os.Exit(code)
+}
+
+func runInfo(name string) func() {
+	return func() {
+		fmt.Printf(`Usage: ./%s %s [-a <assets>|--all] [-e <assets>] [-t <percent>] [-s <USD>] [-m <USD>] [-n <uint>]
+             [-l <uint>] [--priority volume|episodes] [--diff [--download]] [--cpu <cores>]
+             [--dry-run] [--dashboard] [--verbose] [--debug]
+
+Flags            Default   Example   Info
+  -a, --asset              USDT,BTC  assets to arbitrage, separated by ','
+      --all      false               arbitrage all assets with a balance
+  -e, --except             USDC      except these assets
+  -t, --target   2.0       1.7       minimum target in percentage to trade
+  -s, --size     100       500       tradesize measured in USD. (0=balance)
+  -m, --minimum  20        50        minimum tradesize in USD, smaller balances are skipped
+  -n, --decrease 1         2         also look for arbitrages with a decreasing size N times
+  -l, --limit    1024      200       limit maximum connections to orderbooks, complete triangles only
+      --priority volume    episodes  keep triangles by 24h volume or past opportunities under --limit
+      --diff     false               stream orderbook diffs (1sec) instead of snapshots (100ms)
+      --download false               download orderbooks, for '--diff' mode only
+      --cpu      0         2         limit usage of cpu cores (0=all)
+      --dry-run  false               validate orders with the exchange and simulate fills from the book
+      --dashboard false              show a live dashboard instead of the log, which goes to the log file only
+      --verbose  false               log every calculated route
+      --debug    false               log exchange requests
+  -h, --help
+`, appName, name)
+	}
+}
+
+// listValue is a flag of comma separated assets
+type listValue []string
+
+func (l *listValue) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *listValue) Set(s string) error {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		v = strings.ToUpper(strings.TrimSpace(v))
+		if v == "" {
+			return errors.New("empty asset in list")
+		}
+		list = append(list, v)
+	}
+	*l = list
+	return nil
+}
+
+// flagSet is a flag.FlagSet with short aliases and defaults
+// from config.json "Flags" and environment variables
+type flagSet struct {
+	*flag.FlagSet
+	aliases map[string]bool
+}
+
+func newFlagSet(name string) *flagSet {
+	return &flagSet{
+		FlagSet: flag.NewFlagSet(name, flag.ExitOnError),
+		aliases: make(map[string]bool),
+	}
+}
+
+// flagString returns a config Flags value as a flag argument.
+// arrays are joined by commas, as list flags take them
+func flagString(v interface{}) string {
+	list, ok := v.([]interface{})
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	s := make([]string, len(list))
+	for i, e := range list {
+		s[i] = fmt.Sprint(e)
+	}
+	return strings.Join(s, ",")
+}
+
+// alias adds short as another name of flag long
+func (fs *flagSet) alias(short, long string) {
+	f := fs.Lookup(long)
+	fs.Var(f.Value, short, "alias of --"+long)
+	fs.aliases[short] = true
+}
+
+// parse sets flags from config, environment and args in that order
+func (fs *flagSet) parse(args []string) error {
+	var errs []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if fs.aliases[f.Name] {
+			return
+		}
+		if config.Cfg != nil {
+			if v, ok := config.Cfg.Flags[f.Name]; ok {
+				s := flagString(v)
+				if err := f.Value.Set(s); err != nil {
+					errs = append(errs, fmt.Sprintf("config Flags.%s %q: %v", f.Name, s, err))
+				}
+			}
+		}
+		env := envName(f.Name)
+		if v, ok := os.LookupEnv(env); ok {
+			if err := f.Value.Set(v); err != nil {
+				errs = append(errs, fmt.Sprintf("environment %s=%q: %v", env, v, err))
+			}
+		}
+	})
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n  "))
+	}
+	return fs.Parse(args)
+}
+
+// envName returns the environment variable of flag name
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// parseRunFlags parses flags of the run and scan commands into the app arguments
+func parseRunFlags(name string, args []string) {
+	fs := newFlagSet(name)
+	fs.Usage = runInfo(name)
+	fs.Var((*listValue)(&assets), "asset", "")
+	fs.BoolVar(&all, "all", all, "")
+	fs.Var((*listValue)(&except), "except", "")
+	fs.Float64Var(&target, "target", target, "")
+	fs.Float64Var(&size, "size", size, "")
+	fs.Float64Var(&minimum, "minimum", minimum, "")
+	fs.IntVar(&steps, "decrease", steps, "")
+	fs.IntVar(&limit, "limit", limit, "")
+	fs.StringVar(&priority, "priority", priority, "")
+	fs.BoolVar(&obdiff, "diff", obdiff, "")
+	fs.BoolVar(&download, "download", download, "")
+	fs.IntVar(&cpu, "cpu", cpu, "")
+	fs.BoolVar(&dryrun, "dry-run", dryrun, "")
+	fs.BoolVar(&screen, "dashboard", screen, "")
+	fs.BoolVar(&verbose, "verbose", verbose, "")
+	fs.BoolVar(&debug, "debug", debug, "")
+	fs.alias("a", "asset")
+	fs.alias("e", "except")
+	fs.alias("t", "target")
+	fs.alias("s", "size")
+	fs.alias("m", "minimum")
+	fs.alias("n", "decrease")
+	fs.alias("l", "limit")
+	fs.alias("CPU", "cpu")
+
+	err := fs.parse(args)
+	if err == nil {
+		err = validateRunFlags(fs.Args())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s:\n  %v\nrun './%s %s -h' for help\n", name, err, appName, name)
+		os.Exit(2)
+	}
+}
+
+// validateRunFlags checks the app arguments
+func validateRunFlags(rest []string) error {
+	var errs []string
+	if len(rest) > 0 {
+		errs = append(errs, fmt.Sprintf("unexpected arguments %v", rest))
+	}
+	if !all && len(assets) == 0 {
+		errs = append(errs, "--asset or --all is required")
+	}
+	if target <= 0 {
+		errs = append(errs, fmt.Sprintf("--target %v must be above 0", target))
+	}
+	if size < 0 {
+		errs = append(errs, fmt.Sprintf("--size %v must not be negative", size))
+	}
+	if minimum < 0 {
+		errs = append(errs, fmt.Sprintf("--minimum %v must not be negative", minimum))
+	}
+	if size > 0 && minimum > size {
+		errs = append(errs, fmt.Sprintf("--minimum %v is above --size %v", minimum, size))
+	}
+	if steps < 1 {
+		errs = append(errs, fmt.Sprintf("--decrease %d must be at least 1", steps))
+	}
+	if limit < 3 {
+		errs = append(errs, fmt.Sprintf("--limit %d must be at least 3, the books of one triangle", limit))
+	}
+	if priority != "volume" && priority != "episodes" {
+		errs = append(errs, fmt.Sprintf("--priority %q must be volume or episodes", priority))
+	}
+	if cpu < 0 || cpu > runtime.NumCPU() {
+		errs = append(errs, fmt.Sprintf("--cpu %d must be between 0 and %d", cpu, runtime.NumCPU()))
+	}
+	if download && !obdiff {
+		errs = append(errs, "--download needs --diff")
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// configureLog sets log format and levels from config.json, --verbose and --debug
+func configureLog() error {
+	c := config.Cfg.Log
+	if err := logger.Configure(c.Format, c.Level, c.Components); err != nil {
+		return err
+	}
+	if verbose {
+		logger.SetLevel("scanner", logger.Debug)
+	}
+	if debug {
+		logger.SetLevel("client", logger.Debug)
+	}
+	return nil
+}
+
+// connect loads the config file and exchange for commands that need them
+func connect() {
+	if err := config.ReadConfig(); err != nil {
+		fmt.Println("could not load config file:", err)
+		os.Exit(1)
+	}
+	if err := LoadExchange("binance"); err != nil {
+		fmt.Println("could not load exchange:", err)
+		os.Exit(1)
+	}
+}
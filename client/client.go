@@ -4,16 +4,37 @@ import (
 	"encoding/json"
 	"errors"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"strconv"
 	"time"
+
+	"github.com/slicken/arbitrager/logger"
+	"github.com/slicken/arbitrager/metrics"
+)
+
+// loggers of requests and websocket streams
+var (
+	clientLog = logger.New("client")
+	streamLog = logger.New("stream")
+)
+
+var (
+	restRequests = metrics.NewCounter("arbitrager_rest_requests_total", "REST requests by exchange and status code", "exchange", "code")
+	restLatency  = metrics.NewHistogram("arbitrager_rest_latency_seconds", "REST request latency", metrics.DefaultBuckets, "exchange")
 )
 
 // Requester struct for the request client
 type Requester struct {
 	Name       string
 	HTTPClient *http.Client
-	Debug      bool
+	// Debug is kept for exchanges, requests are logged at the client debug level
+	Debug bool
+	// RateLimit is waited on before and updated after each request, if set
+	RateLimit *RateLimit
+	// Weight returns request weight and order count of a request
+	Weight func(method, path string) (weight, orders int)
+	// Classify returns class of an error response
+	Classify func(status, code int, msg string) Class
 }
 
 // DefaultHTTPTimeout holds default timeout
@@ -30,26 +51,103 @@ func NewRequester(name string, httpRequester *http.Client) *Requester {
 	return r
 }
 
+// Usage returns current rate limit usage
+func (r *Requester) Usage() []LimitUsage {
+	if r.RateLimit == nil {
+		return nil
+	}
+	return r.RateLimit.Usage()
+}
+
+// newError returns a classified Error of an error response
+func (r *Requester) newError(status int, content []byte) *Error {
+	e := &Error{Exchange: r.Name, Status: status}
+	var body struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if json.Unmarshal(content, &body) == nil {
+		e.Code, e.Msg = body.Code, body.Msg
+	} else {
+		e.Msg = string(content)
+	}
+
+	switch {
+	case r.Classify != nil:
+		e.Class = r.Classify(status, e.Code, e.Msg)
+	case status == http.StatusTooManyRequests || status == http.StatusTeapot:
+		e.Class = RateLimited
+	case status >= 500:
+		e.Class = Retryable
+	default:
+		e.Class = Fatal
+	}
+	return e
+}
+
+// retryAfter returns how long we are banned by the rate limit,
+// or the Retry-After header of resp without one. 0 if unknown
+func (r *Requester) retryAfter(resp *http.Response) time.Duration {
+	if r.RateLimit != nil {
+		if until, ok := r.RateLimit.Banned(); ok {
+			return time.Until(until)
+		}
+	}
+	if resp != nil {
+		if n, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			return time.Duration(n) * time.Second
+		}
+	}
+	return 0
+}
+
 // Do sends and processes the request
 func (r *Requester) Do(req *http.Request, method, path string, auth bool, result interface{}) error {
 	if r == nil || r.Name == "" {
 		return errors.New("not initalized")
 	}
-	if r.Debug {
-		log.Printf("%s request: %s", r.Name, path)
+	if r.RateLimit != nil {
+		weight, orders := 1, 0
+		if r.Weight != nil {
+			weight, orders = r.Weight(method, path)
+		}
+		if err := r.RateLimit.Wait(weight, orders); err != nil {
+			return &Error{Exchange: r.Name, Class: RateLimited, Err: err, RetryAfter: r.retryAfter(nil)}
+		}
 	}
 
+	start := time.Now()
 	resp, err := r.HTTPClient.Do(req)
+	took := time.Since(start)
+	restLatency.Observe(took.Seconds(), r.Name)
+	// --debug sets the client log level
+	debug := clientLog.Enabled(logger.Debug)
 	if err != nil {
-		return err
+		restRequests.Inc(r.Name, "error")
+		if debug {
+			clientLog.Debug("request failed", "exchange", r.Name, "method", method, "path", path, "latency_ms", logger.Millis(took), "err", err)
+		}
+		return &Error{Exchange: r.Name, Class: Retryable, Err: err}
 	}
+	restRequests.Inc(r.Name, strconv.Itoa(resp.StatusCode))
 	content, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
 	if err != nil {
-		return err
+		// a transport failure like the request error above
+		return &Error{Exchange: r.Name, Class: Retryable, Err: err}
 	}
-	resp.Body.Close()
-	if r.Debug {
-		log.Printf("%s response: %s", r.Name, string(content[:]))
+	if r.RateLimit != nil {
+		r.RateLimit.Update(resp)
+	}
+	if debug {
+		clientLog.Debug("request", "exchange", r.Name, "method", method, "path", path, "status", resp.StatusCode, "latency_ms", logger.Millis(took), "body", string(content))
+	}
+	if resp.StatusCode >= 400 {
+		e := r.newError(resp.StatusCode, content)
+		if e.Class == RateLimited {
+			e.RetryAfter = r.retryAfter(resp)
+		}
+		return e
 	}
 	if result != nil {
 		return json.Unmarshal(content, result)
@@ -57,37 +155,3 @@ func (r *Requester) Do(req *http.Request, method, path string, auth bool, result
 
 	return nil
 }
-
-type RateLimit struct {
-	value int
-	rates []rate
-}
-
-type rate struct {
-	waight int
-	expiry time.Time
-}
-
-func NewRateLimit(value int) *RateLimit {
-	return &RateLimit{value: value}
-}
-
-func (r *RateLimit) Add(waight int, expiry time.Time) {
-	r.rates = append(r.rates, rate{waight: waight, expiry: expiry})
-}
-
-func (r *RateLimit) Get() int {
-	var n = make([]rate, 0)
-
-	rate := r.value
-	for _, v := range r.rates {
-		if time.Now().After(v.expiry) {
-			continue
-		}
-		n = append(n, v)
-		rate -= v.waight
-	}
-
-	r.rates = n
-	return rate
-}
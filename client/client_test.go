@@ -0,0 +1,76 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequesterRetryAfter(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   bool
+		status  int
+		header  string
+		class   Class
+		atLeast time.Duration
+		atMost  time.Duration
+	}{
+		{name: "429 with Retry-After", status: 429, header: "30", class: RateLimited, atLeast: 30 * time.Second, atMost: 30 * time.Second},
+		{name: "418 banned by the limiter", limit: true, status: 418, header: "120", class: RateLimited, atLeast: 119 * time.Second, atMost: 120 * time.Second},
+		{name: "429 without Retry-After", status: 429, class: RateLimited},
+		{name: "server error", status: 503, header: "30", class: Retryable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.header != "" {
+					w.Header().Set("Retry-After", tt.header)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"code":-1003,"msg":"Too many requests"}`))
+			}))
+			defer s.Close()
+
+			r := NewRequester("test", NewHTTPClient(time.Second))
+			if tt.limit {
+				r.RateLimit = testLimits()
+			}
+			req, _ := http.NewRequest("GET", s.URL, nil)
+			err := r.Do(req, "GET", "/", false, nil)
+			if got := ClassOf(err); got != tt.class {
+				t.Fatalf("class %s, want %s", got, tt.class)
+			}
+			if d := RetryAfter(err); tt.class == RateLimited && (d < tt.atLeast || d > tt.atMost) {
+				t.Errorf("RetryAfter %v, want %v-%v", d, tt.atLeast, tt.atMost)
+			} else if tt.class != RateLimited && d != 0 {
+				t.Errorf("RetryAfter %v for a %s error", d, tt.class)
+			}
+			if !tt.limit {
+				return
+			}
+			// the limiter refuses further requests with the same wait
+			err = r.Do(req, "GET", "/", false, nil)
+			if d := RetryAfter(err); ClassOf(err) != RateLimited || d < tt.atLeast-time.Second || d > tt.atMost {
+				t.Errorf("request while banned: %v, RetryAfter %v", err, d)
+			}
+		})
+	}
+}
+
+func TestRequesterReadError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// promise more than is sent, the body read fails
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte(`{"code":`))
+	}))
+	defer s.Close()
+
+	r := NewRequester("test", NewHTTPClient(time.Second))
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	err := r.Do(req, "GET", "/", false, nil)
+	if err == nil || ClassOf(err) != Retryable {
+		t.Errorf("Do = %v, want a retryable error", err)
+	}
+}
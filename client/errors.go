@@ -0,0 +1,104 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Class tells the caller what to do with an exchange error
+type Class int
+
+const (
+	// Fatal errors must not be retried
+	Fatal Class = iota
+	// Retryable errors may succeed if sent again
+	Retryable
+	// RateLimited errors may succeed after the limit resets
+	RateLimited
+	// InsufficientBalance means the account can not pay for the order
+	InsufficientBalance
+	// FilterViolation means the order breaks a symbol filter (size, price, notional)
+	FilterViolation
+	// UnknownOrder means the order does not exist on the exchange
+	UnknownOrder
+)
+
+var classNames = map[Class]string{
+	Fatal:               "fatal",
+	Retryable:           "retryable",
+	RateLimited:         "rate limited",
+	InsufficientBalance: "insufficient balance",
+	FilterViolation:     "filter violation",
+	UnknownOrder:        "unknown order",
+}
+
+func (c Class) String() string {
+	return classNames[c]
+}
+
+// ErrOrderUnknown is returned when we can not tell if an order was placed.
+// the order must not be sent again
+var ErrOrderUnknown = errors.New("order status unknown")
+
+// Error is an error returned by an exchange api
+type Error struct {
+	Exchange string
+	// Status is the http status, 0 if we got no response
+	Status int
+	// Code is the exchange error code
+	Code  int
+	Msg   string
+	Class Class
+	Err   error
+	// RetryAfter is how long a rate limited request should wait, 0 if unknown
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Exchange, e.Class, e.Err)
+	}
+	return fmt.Sprintf("%s: %s: %d %d %s", e.Exchange, e.Class, e.Status, e.Code, e.Msg)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ClassOf returns class of err. errors without a class are fatal,
+// except network errors which are retryable
+func ClassOf(err error) Class {
+	if err == nil {
+		return Fatal
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Class
+	}
+	if errors.Is(err, ErrRateLimited) {
+		return RateLimited
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return Retryable
+	}
+	return Fatal
+}
+
+// RetryAfter returns how long to wait before sending a request that failed
+// with err again, 0 if unknown
+func RetryAfter(err error) time.Duration {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.RetryAfter
+	}
+	return 0
+}
+
+// IsRetryable returns true if err may succeed when the request is sent again
+func IsRetryable(err error) bool {
+	c := ClassOf(err)
+	return c == Retryable || c == RateLimited
+}
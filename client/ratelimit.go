@@ -0,0 +1,177 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when a request would exceed a limit
+var ErrRateLimited = errors.New("rate limit reached")
+
+// Limit is a fixed window request or order limit
+type Limit struct {
+	Name string
+	// Header holds the used count reported by the exchange
+	Header   string
+	Max      int
+	Interval time.Duration
+	// Orders limits count orders instead of request weight
+	Orders bool
+
+	used  int
+	reset time.Time
+}
+
+// LimitUsage holds current usage of a limit
+type LimitUsage struct {
+	Name  string
+	Used  int
+	Max   int
+	Reset time.Time
+}
+
+// RateLimit tracks used request weight and order counts, waits or
+// rejects requests that would exceed them and honors exchange bans
+type RateLimit struct {
+	mu     sync.Mutex
+	limits []*Limit
+	banned time.Time
+	// Headroom is the part of each limit we allow ourself to use
+	Headroom float64
+	// MaxWait is the longest a request waits for a window to reset
+	// before it is rejected
+	MaxWait time.Duration
+}
+
+// NewRateLimit returns a new RateLimit
+func NewRateLimit(limits ...*Limit) *RateLimit {
+	return &RateLimit{
+		limits:   limits,
+		Headroom: 0.9,
+		MaxWait:  10 * time.Second,
+	}
+}
+
+// SetMax updates max of limit name, if it exists
+func (r *RateLimit) SetMax(name string, max int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, l := range r.limits {
+		if l.Name == name {
+			l.Max = max
+		}
+	}
+}
+
+// Wait reserves weight and orders. it blocks until the windows allows it
+// or returns ErrRateLimited if that takes longer than MaxWait or we are banned
+func (r *RateLimit) Wait(weight, orders int) error {
+	for {
+		r.mu.Lock()
+		now := time.Now()
+		if now.Before(r.banned) {
+			until := r.banned
+			r.mu.Unlock()
+			return fmt.Errorf("%w: banned until %s", ErrRateLimited, until.Format("15:04:05"))
+		}
+
+		var wait time.Duration
+		var name string
+		for _, l := range r.limits {
+			l.roll(now)
+			n := weight
+			if l.Orders {
+				n = orders
+			}
+			if n == 0 {
+				continue
+			}
+			if float64(l.used+n) > float64(l.Max)*r.Headroom {
+				if d := l.reset.Sub(now); d > wait {
+					wait, name = d, l.Name
+				}
+			}
+		}
+		if wait == 0 {
+			for _, l := range r.limits {
+				if l.Orders {
+					l.used += orders
+				} else {
+					l.used += weight
+				}
+			}
+			r.mu.Unlock()
+			return nil
+		}
+		r.mu.Unlock()
+
+		if wait > r.MaxWait {
+			return fmt.Errorf("%w: %s resets in %v", ErrRateLimited, name, wait.Round(time.Second))
+		}
+		time.Sleep(wait)
+	}
+}
+
+// Update sets used counts from response headers and bans us on 429 and 418
+func (r *RateLimit) Update(resp *http.Response) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, l := range r.limits {
+		v := resp.Header.Get(l.Header)
+		if v == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(v); err == nil {
+			l.roll(now)
+			l.used = n
+		}
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusTeapot {
+		d := time.Minute
+		if n, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			d = time.Duration(n) * time.Second
+		}
+		if until := now.Add(d); until.After(r.banned) {
+			r.banned = until
+		}
+	}
+}
+
+// Banned returns time of ban end, if banned
+func (r *RateLimit) Banned() (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.banned, time.Now().Before(r.banned)
+}
+
+// Usage returns current usage of all limits
+func (r *RateLimit) Usage() []LimitUsage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var list []LimitUsage
+	for _, l := range r.limits {
+		l.roll(now)
+		list = append(list, LimitUsage{Name: l.Name, Used: l.used, Max: l.Max, Reset: l.reset})
+	}
+	return list
+}
+
+// roll starts a new window if the current has passed
+func (l *Limit) roll(now time.Time) {
+	if now.Before(l.reset) {
+		return
+	}
+	l.used = 0
+	l.reset = now.Truncate(l.Interval).Add(l.Interval)
+}
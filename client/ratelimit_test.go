@@ -0,0 +1,191 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testLimits returns limits with windows long enough not to reset during a test
+func testLimits() *RateLimit {
+	r := NewRateLimit(
+		&Limit{Name: "weight", Header: "X-MBX-USED-WEIGHT-1M", Max: 100, Interval: time.Hour},
+		&Limit{Name: "orders", Header: "X-MBX-ORDER-COUNT-10S", Max: 10, Interval: time.Hour, Orders: true},
+	)
+	r.Headroom = 1
+	r.MaxWait = 0
+	return r
+}
+
+// usage returns used counts by limit name
+func usage(r *RateLimit) map[string]int {
+	m := make(map[string]int)
+	for _, u := range r.Usage() {
+		m[u.Name] = u.Used
+	}
+	return m
+}
+
+func response(status int, headers ...string) *http.Response {
+	resp := &http.Response{StatusCode: status, Header: make(http.Header)}
+	for i := 0; i+1 < len(headers); i += 2 {
+		resp.Header.Set(headers[i], headers[i+1])
+	}
+	return resp
+}
+
+func TestRateLimitWait(t *testing.T) {
+	tests := []struct {
+		name     string
+		headroom float64
+		waits    [][2]int // weight, orders
+		wantErr  []bool
+		want     map[string]int
+	}{
+		{
+			name:    "counts weight and orders",
+			waits:   [][2]int{{10, 0}, {1, 1}, {1, 1}},
+			wantErr: []bool{false, false, false},
+			want:    map[string]int{"weight": 12, "orders": 2},
+		},
+		{
+			name:    "rejects weight above max",
+			waits:   [][2]int{{60, 0}, {50, 0}, {40, 0}},
+			wantErr: []bool{false, true, false},
+			want:    map[string]int{"weight": 100, "orders": 0},
+		},
+		{
+			name:    "rejects orders above max",
+			waits:   [][2]int{{1, 10}, {1, 1}, {1, 0}},
+			wantErr: []bool{false, true, false},
+			want:    map[string]int{"weight": 2, "orders": 10},
+		},
+		{
+			name:     "keeps headroom",
+			headroom: 0.5,
+			waits:    [][2]int{{50, 0}, {1, 0}},
+			wantErr:  []bool{false, true},
+			want:     map[string]int{"weight": 50, "orders": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testLimits()
+			if tt.headroom > 0 {
+				r.Headroom = tt.headroom
+			}
+			for i, w := range tt.waits {
+				err := r.Wait(w[0], w[1])
+				if (err != nil) != tt.wantErr[i] {
+					t.Fatalf("Wait(%d, %d) = %v, want error %v", w[0], w[1], err, tt.wantErr[i])
+				}
+				if err != nil && !errors.Is(err, ErrRateLimited) {
+					t.Errorf("Wait error %v is not ErrRateLimited", err)
+				}
+			}
+			got := usage(r)
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("used %s = %d, want %d", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitWaitsForReset(t *testing.T) {
+	r := NewRateLimit(&Limit{Name: "weight", Max: 10, Interval: 200 * time.Millisecond})
+	r.Headroom = 1
+	r.MaxWait = time.Second
+	if err := r.Wait(10, 0); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := r.Wait(5, 0); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 400*time.Millisecond {
+		t.Errorf("waited %v for a 200ms window", d)
+	}
+	if got := usage(r)["weight"]; got != 5 {
+		t.Errorf("used %d after reset, want 5", got)
+	}
+}
+
+func TestRateLimitUpdate(t *testing.T) {
+	tests := []struct {
+		name       string
+		resp       *http.Response
+		want       map[string]int
+		banned     bool
+		banAtMost  time.Duration
+		banAtLeast time.Duration
+	}{
+		{
+			name: "used weight from headers",
+			resp: response(200, "X-MBX-USED-WEIGHT-1M", "42", "X-MBX-ORDER-COUNT-10S", "3"),
+			want: map[string]int{"weight": 42, "orders": 3},
+		},
+		{
+			name: "missing and bad headers keep counts",
+			resp: response(200, "X-MBX-USED-WEIGHT-1M", "lots"),
+			want: map[string]int{"weight": 5, "orders": 1},
+		},
+		{
+			name:       "429 bans for Retry-After",
+			resp:       response(http.StatusTooManyRequests, "Retry-After", "30", "X-MBX-USED-WEIGHT-1M", "100"),
+			want:       map[string]int{"weight": 100, "orders": 1},
+			banned:     true,
+			banAtLeast: 29 * time.Second,
+			banAtMost:  30 * time.Second,
+		},
+		{
+			name:       "418 bans for Retry-After",
+			resp:       response(http.StatusTeapot, "Retry-After", "7200"),
+			want:       map[string]int{"weight": 5, "orders": 1},
+			banned:     true,
+			banAtLeast: 2*time.Hour - time.Second,
+			banAtMost:  2 * time.Hour,
+		},
+		{
+			name:       "429 without Retry-After bans a minute",
+			resp:       response(http.StatusTooManyRequests),
+			want:       map[string]int{"weight": 5, "orders": 1},
+			banned:     true,
+			banAtLeast: 59 * time.Second,
+			banAtMost:  time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testLimits()
+			if err := r.Wait(5, 1); err != nil {
+				t.Fatal(err)
+			}
+			r.Update(tt.resp)
+
+			got := usage(r)
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("used %s = %d, want %d", k, got[k], v)
+				}
+			}
+			until, banned := r.Banned()
+			if banned != tt.banned {
+				t.Fatalf("banned %v, want %v", banned, tt.banned)
+			}
+			if !banned {
+				return
+			}
+			if d := time.Until(until); d < tt.banAtLeast || d > tt.banAtMost {
+				t.Errorf("banned for %v, want %v-%v", d, tt.banAtLeast, tt.banAtMost)
+			}
+			err := r.Wait(1, 0)
+			if !errors.Is(err, ErrRateLimited) || !strings.Contains(err.Error(), "banned") {
+				t.Errorf("Wait while banned = %v, want a ban error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/slicken/arbitrager/metrics"
+)
+
+var (
+	wsConnected  = metrics.NewGauge("arbitrager_ws_connected", "1 if the websocket connection is up", "conn")
+	wsReconnects = metrics.NewCounter("arbitrager_ws_reconnects_total", "lost websocket connections", "conn")
+)
+
+// Backoff computes jittered exponential delays between reconnects
+type Backoff struct {
+	Min    time.Duration
+	Max    time.Duration
+	Factor float64
+	Jitter float64
+}
+
+// DefaultBackoff holds default reconnect delays
+var DefaultBackoff = Backoff{Min: 500 * time.Millisecond, Max: time.Minute, Factor: 2, Jitter: 0.2}
+
+// Duration returns the delay before reconnect attempt n (starting at 0)
+func (b Backoff) Duration(n int) time.Duration {
+	d := float64(b.Min) * math.Pow(b.Factor, float64(n))
+	if d > float64(b.Max) || math.IsInf(d, 0) {
+		d = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		d += d * b.Jitter * (rand.Float64()*2 - 1)
+	}
+	if d < float64(b.Min) {
+		d = float64(b.Min)
+	}
+	return time.Duration(d)
+}
+
+// ErrNotConnected is returned when writing to a closed connection
+var ErrNotConnected = errors.New("websocket not connected")
+
+// WsConn keeps a websocket connection alive with ping/pong deadlines,
+// reconnects with backoff and replaces the connection before the
+// exchange forcibly closes it after Lifetime
+type WsConn struct {
+	Name string
+	// URL is called before every dial so the endpoint may change between connects
+	URL    func() (string, error)
+	Dialer *websocket.Dialer
+
+	// PingInterval is how often we ping. the connection is dropped when
+	// nothing was read for PingInterval+PongTimeout
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+	// Lifetime after which the connection is replaced. 0 disables
+	Lifetime time.Duration
+	Backoff  Backoff
+
+	// OnMessage is called for every data message
+	OnMessage func(b []byte)
+	// OnConnect is called after every successful dial
+	OnConnect func()
+	// OnDisconnect is called when the connection is lost
+	OnDisconnect func(err error)
+
+	mu         sync.Mutex
+	writeMu    sync.Mutex
+	ws         *websocket.Conn
+	next       *websocket.Conn
+	reconnects int
+	since      time.Time
+	messages   uint64
+}
+
+// NewWsConn returns a WsConn with default keepalive settings
+func NewWsConn(name string, url func() (string, error)) *WsConn {
+	return &WsConn{
+		Name:         name,
+		URL:          url,
+		Dialer:       websocket.DefaultDialer,
+		PingInterval: time.Minute,
+		PongTimeout:  30 * time.Second,
+		Backoff:      DefaultBackoff,
+	}
+}
+
+// Connected returns true when connected and for how long
+func (c *WsConn) Connected() (bool, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ws == nil {
+		return false, 0
+	}
+	return true, time.Since(c.since)
+}
+
+// Reconnects returns number of lost connections
+func (c *WsConn) Reconnects() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.reconnects
+}
+
+// Messages returns number of data messages read
+func (c *WsConn) Messages() uint64 {
+	return atomic.LoadUint64(&c.messages)
+}
+
+// WriteJSON writes v to the current connection
+func (c *WsConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	ws := c.ws
+	c.mu.Unlock()
+	if ws == nil {
+		return ErrNotConnected
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return ws.WriteJSON(v)
+}
+
+// Run connects and reads until ctx is done
+func (c *WsConn) Run(ctx context.Context) {
+	done := ctx.Done()
+	attempt := 0
+	for {
+		ws, err := c.dial()
+		if err != nil {
+			if !c.wait(done, attempt, err) {
+				return
+			}
+			attempt++
+			continue
+		}
+
+		for ws != nil {
+			c.setConn(ws)
+			if c.OnConnect != nil {
+				c.OnConnect()
+			}
+			err = c.serve(ws, done)
+
+			c.mu.Lock()
+			ws, c.next = c.next, nil
+			c.mu.Unlock()
+			if ws != nil {
+				streamLog.Info("connection replaced", "stream", c.Name)
+			}
+		}
+
+		c.mu.Lock()
+		if time.Since(c.since) > c.Backoff.Max {
+			attempt = 0
+		}
+		c.ws = nil
+		c.mu.Unlock()
+		wsConnected.Set(0, c.Name)
+
+		select {
+		case <-done:
+			return
+		default:
+		}
+		c.mu.Lock()
+		c.reconnects++
+		c.mu.Unlock()
+		wsReconnects.Inc(c.Name)
+		if c.OnDisconnect != nil {
+			c.OnDisconnect(err)
+		}
+		if !c.wait(done, attempt, err) {
+			return
+		}
+		attempt++
+	}
+}
+
+// wait sleeps before next reconnect attempt. returns false if done
+func (c *WsConn) wait(done <-chan struct{}, attempt int, err error) bool {
+	d := c.Backoff.Duration(attempt)
+	streamLog.Warn("reconnecting", "stream", c.Name, "in", d.Round(time.Millisecond).String(), "err", err)
+
+	select {
+	case <-done:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+func (c *WsConn) dial() (*websocket.Conn, error) {
+	url, err := c.URL()
+	if err != nil {
+		return nil, err
+	}
+	ws, _, err := c.Dialer.Dial(url, nil)
+	return ws, err
+}
+
+func (c *WsConn) setConn(ws *websocket.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ws = ws
+	c.since = time.Now()
+	wsConnected.Set(1, c.Name)
+}
+
+// serve reads from ws and keeps it alive until it fails, is replaced or done
+func (c *WsConn) serve(ws *websocket.Conn, done <-chan struct{}) error {
+	timeout := c.PingInterval + c.PongTimeout
+	extend := func() {
+		ws.SetReadDeadline(time.Now().Add(timeout))
+	}
+	extend()
+	ws.SetPongHandler(func(string) error {
+		extend()
+		return nil
+	})
+	ws.SetPingHandler(func(msg string) error {
+		extend()
+		err := ws.WriteControl(websocket.PongMessage, []byte(msg), time.Now().Add(c.PongTimeout))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+
+	stop := make(chan bool)
+	defer func() {
+		close(stop)
+		ws.Close()
+	}()
+	go c.keepAlive(ws, done, stop)
+
+	for {
+		_, b, err := ws.ReadMessage()
+		if err != nil {
+			select {
+			case <-done:
+				return nil
+			default:
+			}
+			return err
+		}
+		extend()
+		atomic.AddUint64(&c.messages, 1)
+		if c.OnMessage != nil {
+			c.OnMessage(b)
+		}
+	}
+}
+
+// keepAlive pings ws, replaces it after Lifetime and closes it when done
+func (c *WsConn) keepAlive(ws *websocket.Conn, done <-chan struct{}, stop <-chan bool) {
+	ping := time.NewTicker(c.PingInterval)
+	defer ping.Stop()
+
+	var rotate <-chan time.Time
+	if c.Lifetime > 0 {
+		rotate = time.After(c.Lifetime)
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+
+		case <-done:
+			ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			ws.Close()
+			return
+
+		case <-ping.C:
+			if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.PongTimeout)); err != nil {
+				streamLog.Warn("ping failed", "stream", c.Name, "err", err)
+				ws.Close()
+				return
+			}
+
+		case <-rotate:
+			next, err := c.dial()
+			if err != nil {
+				streamLog.Warn("could not replace connection", "stream", c.Name, "err", err)
+				rotate = time.After(time.Minute)
+				continue
+			}
+			c.mu.Lock()
+			c.next = next
+			c.mu.Unlock()
+			ws.Close()
+			return
+		}
+	}
+}
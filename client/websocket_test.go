@@ -0,0 +1,185 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{}
+
+// wsServer starts a websocket server running handle for every connection
+func wsServer(t *testing.T, handle func(n int, ws *websocket.Conn)) string {
+	var mu sync.Mutex
+	n := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		mu.Lock()
+		n++
+		i := n
+		mu.Unlock()
+		handle(i, ws)
+	}))
+	t.Cleanup(s.Close)
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+func testConn(url string) *WsConn {
+	c := NewWsConn("test", func() (string, error) { return url, nil })
+	c.Backoff = Backoff{Min: 50 * time.Millisecond, Max: 200 * time.Millisecond, Factor: 2}
+	return c
+}
+
+func TestBackoffDuration(t *testing.T) {
+	b := Backoff{Min: 100 * time.Millisecond, Max: time.Second, Factor: 2}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{3, 800 * time.Millisecond},
+		{4, time.Second},
+		{1000, time.Second},
+	}
+	for _, tt := range tests {
+		if got := b.Duration(tt.attempt); got != tt.want {
+			t.Errorf("Duration(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := b.Duration(2); d < 200*time.Millisecond || d > 600*time.Millisecond {
+			t.Fatalf("Duration(2) with jitter = %v, want 200ms-600ms", d)
+		}
+	}
+}
+
+func TestWsConnReconnect(t *testing.T) {
+	url := wsServer(t, func(n int, ws *websocket.Conn) {
+		ws.WriteMessage(websocket.TextMessage, []byte{byte('0' + n)})
+		if n == 1 {
+			// drop the first connection without a close frame
+			ws.UnderlyingConn().Close()
+			return
+		}
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	c := testConn(url)
+	msgs := make(chan string, 10)
+	dropped := make(chan time.Time, 10)
+	connected := make(chan time.Time, 10)
+	c.OnMessage = func(b []byte) { msgs <- string(b) }
+	c.OnDisconnect = func(err error) { dropped <- time.Now() }
+	c.OnConnect = func() { connected <- time.Now() }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	for _, want := range []string{"1", "2"} {
+		select {
+		case got := <-msgs:
+			if got != want {
+				t.Fatalf("message %q, want %q", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no message %q", want)
+		}
+	}
+	<-connected
+	at := <-dropped
+	again := <-connected
+	if d := again.Sub(at); d < c.Backoff.Min {
+		t.Errorf("reconnected after %v, want at least %v", d, c.Backoff.Min)
+	}
+	if n := c.Reconnects(); n != 1 {
+		t.Errorf("Reconnects() = %d, want 1", n)
+	}
+	if ok, _ := c.Connected(); !ok {
+		t.Error("not connected after reconnect")
+	}
+}
+
+func TestWsConnPongDeadline(t *testing.T) {
+	tests := []struct {
+		name string
+		// pong answers pings by reading, the server only pongs while reading
+		pong     bool
+		wantDrop bool
+	}{
+		{"pings answered", true, false},
+		{"pings ignored", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quit := make(chan bool)
+			url := wsServer(t, func(n int, ws *websocket.Conn) {
+				if tt.pong {
+					for {
+						if _, _, err := ws.ReadMessage(); err != nil {
+							return
+						}
+					}
+				}
+				<-quit
+			})
+			defer close(quit)
+
+			c := testConn(url)
+			c.PingInterval = 50 * time.Millisecond
+			c.PongTimeout = 50 * time.Millisecond
+			dropped := make(chan error, 10)
+			c.OnDisconnect = func(err error) { dropped <- err }
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan bool)
+			go func() {
+				c.Run(ctx)
+				close(done)
+			}()
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			select {
+			case err := <-dropped:
+				if !tt.wantDrop {
+					t.Fatalf("dropped: %v", err)
+				}
+				if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+					t.Errorf("dropped with %v, want a timeout", err)
+				}
+			case <-time.After(500 * time.Millisecond):
+				if tt.wantDrop {
+					t.Fatal("not dropped after the pong deadline")
+				}
+			}
+		})
+	}
+}
@@ -18,6 +18,15 @@ var m sync.Mutex
 type Config struct {
 	Exchanges []ExchangeConfig `json:"Exchanges"`
 	Email     EmailConfig      `json:"Email"`
+	Alerts    AlertsConfig     `json:"Alerts"`
+	Risk      RiskConfig       `json:"Risk"`
+	Confirm   ConfirmConfig    `json:"Confirm"`
+	Episodes  EpisodesConfig   `json:"Episodes"`
+	Metrics   MetricsConfig    `json:"Metrics"`
+	Control   ControlConfig    `json:"Control"`
+	Log       LogConfig        `json:"Log"`
+	// Flags holds defaults of command flags by long name, eg. "target": 1.7
+	Flags map[string]interface{} `json:"Flags,omitempty"`
 }
 
 // ExchangeConfig holds all the information needed for each enabled Exchange.
@@ -27,6 +36,8 @@ type ExchangeConfig struct {
 	Key      string
 	Secret   string
 	Password string `json:",omitempty"`
+	// RecvWindow in milliseconds for signed requests
+	RecvWindow int64 `json:",omitempty"`
 }
 
 // EmailConfig for sender
@@ -35,6 +46,118 @@ type EmailConfig struct {
 	Pass string
 	SMTP string
 	PORT string
+	// To are the recipients, User if empty
+	To []string `json:",omitempty"`
+	// DigestMinutes is how often other than urgent alerts are batched and sent
+	DigestMinutes int `json:",omitempty"`
+	// MaxPerHour limits emails sent per hour, queued alerts wait for the next digest
+	MaxPerHour int `json:",omitempty"`
+}
+
+// AlertsConfig holds alert sinks other than email and which events they get
+type AlertsConfig struct {
+	Webhook  WebhookConfig
+	Telegram TelegramConfig
+	Slack    SlackConfig
+	// Routes maps event kinds to sink names: email, webhook, telegram or slack.
+	// "*" routes trade, failed, risk, start, stop and outage events, which go to
+	// all sinks without routes. opportunity, decision and order are only sent if routed
+	Routes map[string][]string `json:",omitempty"`
+	// Retries of a failed send, with backoff from 1 second
+	Retries int
+	// OutageSeconds a stream must be down before it is alerted
+	OutageSeconds int
+}
+
+// WebhookConfig posts every event as json to URL
+type WebhookConfig struct {
+	URL string
+	// Template is a text/template of the body executed with the event,
+	// eg. {"text": {{json .Subject}}}. empty posts the event as json
+	Template string            `json:",omitempty"`
+	Headers  map[string]string `json:",omitempty"`
+	// DigestMinutes batches other than urgent events, 0 sends them at once
+	DigestMinutes int `json:",omitempty"`
+	// MaxPerHour limits sends per hour, 0 is unlimited
+	MaxPerHour int `json:",omitempty"`
+}
+
+// TelegramConfig sends events from a telegram bot to a chat
+type TelegramConfig struct {
+	Token         string
+	ChatID        string
+	DigestMinutes int `json:",omitempty"`
+	MaxPerHour    int `json:",omitempty"`
+}
+
+// SlackConfig sends events to a slack compatible incoming webhook URL
+type SlackConfig struct {
+	URL           string
+	DigestMinutes int `json:",omitempty"`
+	MaxPerHour    int `json:",omitempty"`
+}
+
+// RiskConfig holds trading limits. zero disables a limit
+type RiskConfig struct {
+	// MaxNotional is the largest route size in USD
+	MaxNotional float64
+	// MaxDailyLoss in USD halts trading for the rest of the day
+	MaxDailyLoss float64
+	// MaxConsecutiveLosses halts trading until resumed
+	MaxConsecutiveLosses int
+	// MaxStranded is the largest value in USD left by failed routes
+	MaxStranded float64
+	// KillFile halts trading while it exists
+	KillFile string
+}
+
+// ConfirmConfig holds checks an opportunity must pass before it is traded.
+// all enabled checks must pass, zero disables a check
+type ConfirmConfig struct {
+	// Updates is the number of consecutive book updates it must persist
+	Updates int
+	// Millis is how long in milliseconds it must persist
+	Millis int
+	// BookTicker checks it against fresh best prices over REST
+	BookTicker bool
+}
+
+// EpisodesConfig holds opportunity analytics settings
+type EpisodesConfig struct {
+	// Threshold in percent a route must reach to start an episode. zero disables
+	Threshold float64
+}
+
+// MetricsConfig holds the prometheus endpoint settings
+type MetricsConfig struct {
+	// Listen is the address serving /metrics, eg. "127.0.0.1:9100". empty disables
+	Listen string
+}
+
+// ControlConfig holds the control api settings
+type ControlConfig struct {
+	// Listen is the address serving the api, eg. "127.0.0.1:9101". empty disables
+	Listen string
+	// Token must be sent as "Authorization: Bearer <Token>". the api is not
+	// served without one, or with "CHANGE_ME" of the example config
+	Token string
+}
+
+// LogConfig holds log format and levels
+type LogConfig struct {
+	// Format is "text" or "json"
+	Format string
+	// Level is the default level: debug, info, warn or error
+	Level string
+	// Components overrides Level by component: scanner, trade, client, stream or risk
+	Components map[string]string `json:",omitempty"`
+	// Dir holds log files, the working directory if empty
+	Dir string `json:",omitempty"`
+	// MaxSizeMB rotates the log file when it grows above, files are also rotated daily. 0=no limit
+	MaxSizeMB int `json:",omitempty"`
+	// MaxFiles and MaxAgeDays limit the compressed old files kept. 0=keep all
+	MaxFiles   int `json:",omitempty"`
+	MaxAgeDays int `json:",omitempty"`
 }
 
 // ReadConfig file
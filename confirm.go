@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/slicken/arbitrager/confirm"
+)
+
+// confirmBookTicker recalculates o with fresh best prices over REST.
+// like calcDepthProfits it leaves out fees, best prices can only do better
+// than the depth prices of o so the route must still reach its target
+func confirmBookTicker(o *OrderSet) (bool, string) {
+	var bid, ask [3]float64
+	var errs [3]error
+	var wg sync.WaitGroup
+	for i, p := range o.pair {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			bid[i], ask[i], errs[i] = E.GetBookTicker(name)
+		}(i, p.Name)
+	}
+	wg.Wait()
+
+	next := 1.0
+	for i, side := range o.route {
+		if errs[i] != nil {
+			return false, errs[i].Error()
+		}
+		switch side {
+		case buy:
+			if ask[i] == 0 {
+				return false, "no ask on " + o.pair[i].Name
+			}
+			next /= ask[i]
+		case sell:
+			next *= bid[i]
+		}
+	}
+	perc := next*100 - 100
+	if min := target + o.margin; min > perc {
+		return false, fmt.Sprintf("%.2f%% < target %.2f%%", perc, min)
+	}
+	return true, ""
+}
+
+// logConfirmStats logs how many candidates each confirm check filtered
+func logConfirmStats() {
+	st := confirm.GetStats()
+	log.Printf("candidates %d, confirmed %d, pending %d, filtered by updates %d, by time %d, by book ticker %d\n",
+		st.Candidates, st.Confirmed, st.Pending, st.Updates, st.Window, st.BookTicker)
+}
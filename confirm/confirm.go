@@ -0,0 +1,118 @@
+package confirm
+
+import (
+	"sync"
+	"time"
+
+	"github.com/slicken/arbitrager/config"
+)
+
+// Stats counts candidates and how many each check filtered.
+// a candidate that vanished before it persisted counts once
+// for every persistence check it had not passed yet
+type Stats struct {
+	Candidates int
+	Confirmed  int
+	Pending    int
+	Updates    int
+	Window     int
+	BookTicker int
+}
+
+type candidate struct {
+	first   time.Time
+	last    time.Time
+	updates int
+}
+
+// a candidate not seen for staleAfter starts over, eg. after a cooldown
+const staleAfter = 5 * time.Second
+
+var (
+	mu      sync.Mutex
+	policy  config.ConfirmConfig
+	pending = make(map[string]*candidate)
+	stats   Stats
+)
+
+// SetPolicy sets the checks opportunities must pass
+func SetPolicy(p config.ConfirmConfig) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	policy = p
+}
+
+// Policy returns the current checks
+func Policy() config.ConfirmConfig {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return policy
+}
+
+// Seen records a book update where key is an opportunity.
+// it returns true once key has persisted long enough to be traded
+func Seen(key string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	c, ok := pending[key]
+	if !ok || now.Sub(c.last) > staleAfter {
+		c = &candidate{first: now}
+		pending[key] = c
+		stats.Candidates++
+	}
+	c.updates++
+	c.last = now
+
+	if c.updates < policy.Updates || now.Sub(c.first) < time.Duration(policy.Millis)*time.Millisecond {
+		return false
+	}
+	delete(pending, key)
+	if !policy.BookTicker {
+		stats.Confirmed++
+	}
+	return true
+}
+
+// Gone records a book update where key is no longer an opportunity
+func Gone(key string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	c, ok := pending[key]
+	if !ok {
+		return
+	}
+	delete(pending, key)
+	if c.updates < policy.Updates {
+		stats.Updates++
+	}
+	if time.Since(c.first) < time.Duration(policy.Millis)*time.Millisecond {
+		stats.Window++
+	}
+}
+
+// BookTicker records the result of a REST check of a persisted candidate
+func BookTicker(ok bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if ok {
+		stats.Confirmed++
+	} else {
+		stats.BookTicker++
+	}
+}
+
+// GetStats returns counters since start
+func GetStats() Stats {
+	mu.Lock()
+	defer mu.Unlock()
+
+	s := stats
+	s.Pending = len(pending)
+	return s
+}
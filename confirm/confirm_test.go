@@ -0,0 +1,143 @@
+package confirm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/slicken/arbitrager/config"
+)
+
+// reset starts over with policy p
+func reset(p config.ConfirmConfig) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	policy = p
+	pending = make(map[string]*candidate)
+	stats = Stats{}
+}
+
+// age moves the candidate of key back in time by d
+func age(key string, d time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if c, ok := pending[key]; ok {
+		c.first = c.first.Add(-d)
+		c.last = c.last.Add(-d)
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	type step struct {
+		op   string        // seen, gone, ticker ok or ticker failed
+		ago  time.Duration // ages the candidate before the step
+		want bool          // result of seen
+	}
+	tests := []struct {
+		name   string
+		policy config.ConfirmConfig
+		steps  []step
+		want   Stats
+	}{
+		{
+			name:  "no checks",
+			steps: []step{{op: "seen", want: true}},
+			want:  Stats{Candidates: 1, Confirmed: 1},
+		},
+		{
+			name:   "updates",
+			policy: config.ConfirmConfig{Updates: 3},
+			steps:  []step{{op: "seen"}, {op: "seen"}, {op: "seen", want: true}},
+			want:   Stats{Candidates: 1, Confirmed: 1},
+		},
+		{
+			name:   "window",
+			policy: config.ConfirmConfig{Millis: 100},
+			steps:  []step{{op: "seen"}, {op: "seen"}, {op: "seen", ago: 200 * time.Millisecond, want: true}},
+			want:   Stats{Candidates: 1, Confirmed: 1},
+		},
+		{
+			name:   "updates and window",
+			policy: config.ConfirmConfig{Updates: 2, Millis: 100},
+			steps:  []step{{op: "seen"}, {op: "seen"}, {op: "seen", ago: 200 * time.Millisecond, want: true}},
+			want:   Stats{Candidates: 1, Confirmed: 1},
+		},
+		{
+			name:   "pending",
+			policy: config.ConfirmConfig{Updates: 3},
+			steps:  []step{{op: "seen"}, {op: "seen"}},
+			want:   Stats{Candidates: 1, Pending: 1},
+		},
+		{
+			name:   "gone before updates",
+			policy: config.ConfirmConfig{Updates: 3},
+			steps:  []step{{op: "seen"}, {op: "seen"}, {op: "gone"}},
+			want:   Stats{Candidates: 1, Updates: 1},
+		},
+		{
+			name:   "gone before updates and window",
+			policy: config.ConfirmConfig{Updates: 3, Millis: 100},
+			steps:  []step{{op: "seen"}, {op: "gone"}},
+			want:   Stats{Candidates: 1, Updates: 1, Window: 1},
+		},
+		{
+			name:   "gone after updates before window",
+			policy: config.ConfirmConfig{Updates: 2, Millis: 100},
+			steps:  []step{{op: "seen"}, {op: "seen"}, {op: "gone"}},
+			want:   Stats{Candidates: 1, Window: 1},
+		},
+		{
+			name:  "gone without candidate",
+			steps: []step{{op: "gone"}},
+		},
+		{
+			name:   "stale candidate starts over",
+			policy: config.ConfirmConfig{Updates: 2},
+			steps:  []step{{op: "seen"}, {op: "seen", ago: staleAfter + time.Second}, {op: "seen", want: true}},
+			want:   Stats{Candidates: 2, Confirmed: 1},
+		},
+		{
+			name:   "candidate within stale window",
+			policy: config.ConfirmConfig{Updates: 2},
+			steps:  []step{{op: "seen"}, {op: "seen", ago: staleAfter - time.Second, want: true}},
+			want:   Stats{Candidates: 1, Confirmed: 1},
+		},
+		{
+			name:   "book ticker confirms",
+			policy: config.ConfirmConfig{BookTicker: true},
+			steps:  []step{{op: "seen", want: true}, {op: "ticker ok"}},
+			want:   Stats{Candidates: 1, Confirmed: 1},
+		},
+		{
+			name:   "book ticker rejects",
+			policy: config.ConfirmConfig{BookTicker: true},
+			steps:  []step{{op: "seen", want: true}, {op: "ticker failed"}},
+			want:   Stats{Candidates: 1, BookTicker: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const key = "USDT BTC ETH"
+			reset(tt.policy)
+			for i, s := range tt.steps {
+				age(key, s.ago)
+				switch s.op {
+				case "seen":
+					if got := Seen(key); got != s.want {
+						t.Errorf("step %d: Seen = %v, want %v", i, got, s.want)
+					}
+				case "gone":
+					Gone(key)
+				case "ticker ok":
+					BookTicker(true)
+				case "ticker failed":
+					BookTicker(false)
+				}
+			}
+			if got := GetStats(); got != tt.want {
+				t.Errorf("stats %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
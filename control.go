@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/slicken/arbitrager/balance"
+	"github.com/slicken/arbitrager/currencie"
+	"github.com/slicken/arbitrager/orderbook"
+	"github.com/slicken/arbitrager/pnl"
+	"github.com/slicken/arbitrager/risk"
+)
+
+// controlRequest is run by the scanner, so it never races a check or a route
+type controlRequest struct {
+	fn    func() (interface{}, error)
+	reply chan controlReply
+}
+
+type controlReply struct {
+	v   interface{}
+	err error
+}
+
+// controlC passes api requests to the scanner
+var controlC = make(chan controlRequest)
+
+// streamed holds the subscribed books
+var streamed = make(map[string]bool)
+
+// subscribe streams the book of pair into notify
+func subscribe(ctx context.Context, pair string, notify *orderbook.Notifier) error {
+	var err error
+	if obdiff {
+		err = E.StreamBookDiff(ctx, pair, notify)
+	} else {
+		err = E.StreamBookDepth(ctx, pair, notify)
+	}
+	if err == nil {
+		streamed[pair] = true
+	}
+	return err
+}
+
+// unsubscribe stops streaming the book of pair
+func unsubscribe(pair string, notify *orderbook.Notifier) error {
+	if err := E.Unsubscribe(pair); err != nil {
+		return err
+	}
+	notify.Remove(pair)
+	delete(streamed, pair)
+	return nil
+}
+
+// controlStatus is returned by GET /status
+type controlStatus struct {
+	Uptime        string   `json:"uptime"`
+	Mode          string   `json:"mode"`
+	Halted        string   `json:"halted,omitempty"`
+	CooldownUntil string   `json:"cooldown_until,omitempty"`
+	Target        float64  `json:"target"`
+	Size          float64  `json:"size"`
+	Minimum       float64  `json:"minimum"`
+	Decrease      int      `json:"decrease"`
+	Assets        []string `json:"assets"`
+	Except        []string `json:"except"`
+	Routes        int      `json:"routes"`
+	Books         int      `json:"books"`
+	Opportunities int      `json:"opportunities"`
+	Executed      int      `json:"executed"`
+	Failed        int      `json:"failed"`
+	TodayPnL      float64  `json:"today_pnl_usdt"`
+	TodayTrades   int      `json:"today_trades"`
+}
+
+func status() controlStatus {
+	mode := "trading"
+	if scanOnly {
+		mode = "scan only"
+	} else if dryrun {
+		mode = "dry run"
+	}
+	halted, _ := risk.Halted()
+	cooldown := ""
+	if time.Now().Before(lastTrade) {
+		cooldown = lastTrade.Format(time.RFC3339)
+	}
+	today := pnl.Today()
+	return controlStatus{
+		Uptime:        time.Since(started).Round(time.Second).String(),
+		Mode:          mode,
+		Halted:        halted,
+		CooldownUntil: cooldown,
+		Target:        target,
+		Size:          size,
+		Minimum:       minimum,
+		Decrease:      steps,
+		Assets:        assets,
+		Except:        except,
+		Routes:        len(allSets()),
+		Books:         len(streamed),
+		Opportunities: found,
+		Executed:      executed,
+		Failed:        failed,
+		TodayPnL:      today.PnL,
+		TodayTrades:   today.Trades,
+	}
+}
+
+// settingsRequest holds settings to change, nil fields are kept
+type settingsRequest struct {
+	Target   *float64 `json:"target"`
+	Size     *float64 `json:"size"`
+	Minimum  *float64 `json:"minimum"`
+	Decrease *int     `json:"decrease"`
+}
+
+// apply validates and sets the settings
+func (r settingsRequest) apply() error {
+	t, s, m, n := target, size, minimum, steps
+	if r.Target != nil {
+		t = *r.Target
+	}
+	if r.Size != nil {
+		s = *r.Size
+	}
+	if r.Minimum != nil {
+		m = *r.Minimum
+	}
+	if r.Decrease != nil {
+		n = *r.Decrease
+	}
+	var errs []string
+	if t <= 0 {
+		errs = append(errs, fmt.Sprintf("target %v must be above 0", t))
+	}
+	if s < 0 {
+		errs = append(errs, fmt.Sprintf("size %v must not be negative", s))
+	}
+	if m < 0 {
+		errs = append(errs, fmt.Sprintf("minimum %v must not be negative", m))
+	}
+	if s > 0 && m > s {
+		errs = append(errs, fmt.Sprintf("minimum %v is above size %v", m, s))
+	}
+	if n < 1 {
+		errs = append(errs, fmt.Sprintf("decrease %d must be at least 1", n))
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	target, size, minimum, steps = t, s, m, n
+	log.Printf("settings changed: target %.2f%%, size %.2f, minimum %.2f, decrease %d\n", target, size, minimum, steps)
+	return nil
+}
+
+// assetsRequest holds assets to arbitrage, nil fields are kept
+type assetsRequest struct {
+	Assets []string `json:"assets"`
+	All    *bool    `json:"all"`
+	Except []string `json:"except"`
+}
+
+// assetsReply lists books subscribed and unsubscribed by an assets change
+type assetsReply struct {
+	Assets       []string `json:"assets"`
+	Routes       int      `json:"routes"`
+	Subscribed   []string `json:"subscribed"`
+	Unsubscribed []string `json:"unsubscribed"`
+	Errors       []string `json:"errors,omitempty"`
+}
+
+// apply rebuilds the sets of the new assets and subscribes only the books that changed
+func (r assetsRequest) apply(ctx context.Context, notify *orderbook.Notifier) (assetsReply, error) {
+	oldAssets, oldExcept, oldAll := assets, except, all
+	// selectAssets removes except in place
+	assets = append([]string(nil), assets...)
+	if r.Assets != nil {
+		var list listValue
+		if len(r.Assets) > 0 {
+			if err := list.Set(strings.Join(r.Assets, ",")); err != nil {
+				return assetsReply{}, err
+			}
+		}
+		assets = list
+	}
+	if r.Except != nil {
+		var list listValue
+		if len(r.Except) > 0 {
+			if err := list.Set(strings.Join(r.Except, ",")); err != nil {
+				return assetsReply{}, err
+			}
+		}
+		except = list
+	}
+	if r.All != nil {
+		all = *r.All
+	}
+	if all {
+		assets = nil
+	}
+	if err := selectAssets(); err != nil {
+		assets, except, all = oldAssets, oldExcept, oldAll
+		return assetsReply{}, err
+	}
+
+	SetsMap = make(map[currencie.Pair]Sets)
+	mapSets()
+	pairs := selectPairs()
+
+	var reply assetsReply
+	keep := make(map[string]bool)
+	for _, pair := range pairs {
+		keep[pair] = true
+	}
+	for pair := range streamed {
+		if keep[pair] {
+			continue
+		}
+		if err := unsubscribe(pair, notify); err != nil {
+			reply.Errors = append(reply.Errors, fmt.Sprintf("unsubscribe %s: %v", pair, err))
+			continue
+		}
+		reply.Unsubscribed = append(reply.Unsubscribed, pair)
+	}
+	for _, pair := range pairs {
+		if streamed[pair] {
+			continue
+		}
+		if err := subscribe(ctx, pair, notify); err != nil {
+			reply.Errors = append(reply.Errors, fmt.Sprintf("subscribe %s: %v", pair, err))
+			continue
+		}
+		reply.Subscribed = append(reply.Subscribed, pair)
+	}
+	sort.Strings(reply.Unsubscribed)
+	sort.Strings(reply.Subscribed)
+	reply.Assets = assets
+	reply.Routes = len(allSets())
+	log.Printf("assets changed to %v: %d books subscribed, %d unsubscribed\n", assets, len(reply.Subscribed), len(reply.Unsubscribed))
+	return reply, nil
+}
+
+// cancelReply lists cancelled orders
+type cancelReply struct {
+	Cancelled []int64  `json:"cancelled"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// cancelAll cancels all open orders on the exchange
+func cancelAll() (cancelReply, error) {
+	var reply cancelReply
+	list, err := E.GetOpenOrders()
+	if err != nil {
+		return reply, err
+	}
+	for _, o := range list {
+		if err := E.SendCancel(o.Pair, o.ID); err != nil {
+			reply.Errors = append(reply.Errors, fmt.Sprintf("%s %d: %v", o.Pair, o.ID, err))
+			continue
+		}
+		reply.Cancelled = append(reply.Cancelled, o.ID)
+	}
+	log.Printf("cancelled %d of %d open orders\n", len(reply.Cancelled), len(list))
+	return reply, nil
+}
+
+// balances returns non zero balances
+func balances() []*balance.Balance {
+	var list []*balance.Balance
+	for _, b := range balance.Balances {
+		if b.Free+b.Locked > 0 {
+			list = append(list, b)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Asset < list[j].Asset
+	})
+	return list
+}
+
+// serveControl serves the control api on addr until ctx is done. every
+// request needs the header "Authorization: Bearer <token>"
+func serveControl(ctx context.Context, addr, token string, notify *orderbook.Notifier) {
+	mux := http.NewServeMux()
+	handle := func(path, method string, fn func(r *http.Request) (interface{}, error)) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			auth := r.Header.Get("Authorization")
+			if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(token)) != 1 {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+				return
+			}
+			if r.Method != method {
+				writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use " + method})
+				return
+			}
+			v, err := fn(r)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, v)
+		})
+	}
+
+	handle("/status", http.MethodGet, func(r *http.Request) (interface{}, error) {
+		return onScanner(ctx, func() (interface{}, error) {
+			return status(), nil
+		})
+	})
+	handle("/pause", http.MethodPost, func(r *http.Request) (interface{}, error) {
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if err := decode(r, &req); err != nil {
+			return nil, err
+		}
+		if req.Reason == "" {
+			req.Reason = "paused by api"
+		}
+		risk.Halt(req.Reason)
+		return map[string]string{"halted": req.Reason}, nil
+	})
+	handle("/resume", http.MethodPost, func(r *http.Request) (interface{}, error) {
+		risk.Resume()
+		return map[string]string{"halted": ""}, nil
+	})
+	handle("/settings", http.MethodPost, func(r *http.Request) (interface{}, error) {
+		var req settingsRequest
+		if err := decode(r, &req); err != nil {
+			return nil, err
+		}
+		return onScanner(ctx, func() (interface{}, error) {
+			if err := req.apply(); err != nil {
+				return nil, err
+			}
+			return status(), nil
+		})
+	})
+	handle("/assets", http.MethodPost, func(r *http.Request) (interface{}, error) {
+		var req assetsRequest
+		if err := decode(r, &req); err != nil {
+			return nil, err
+		}
+		return onScanner(ctx, func() (interface{}, error) {
+			return req.apply(ctx, notify)
+		})
+	})
+	handle("/stranded", http.MethodPost, func(r *http.Request) (interface{}, error) {
+		var req struct {
+			Assets []string `json:"assets"`
+		}
+		if err := decode(r, &req); err != nil {
+			return nil, err
+		}
+		return onScanner(ctx, func() (interface{}, error) {
+			for i := range req.Assets {
+				req.Assets[i] = strings.ToUpper(req.Assets[i])
+			}
+			cleared := pnl.ClearStranded(req.Assets...)
+			if err := pnl.Save(); err != nil {
+				return nil, err
+			}
+			updateMetrics()
+			return map[string]interface{}{"cleared": cleared}, nil
+		})
+	})
+	handle("/balance", http.MethodPost, func(r *http.Request) (interface{}, error) {
+		return onScanner(ctx, func() (interface{}, error) {
+			if err := E.UpdateBalance(); err != nil {
+				return nil, err
+			}
+			updateMetrics()
+			return balances(), nil
+		})
+	})
+	handle("/cancel", http.MethodPost, func(r *http.Request) (interface{}, error) {
+		return onScanner(ctx, func() (interface{}, error) {
+			return cancelAll()
+		})
+	})
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(c)
+	}()
+	go func() {
+		log.Printf("serving control api on http://%s\n", addr)
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			log.Println("control api failed:", err.Error())
+		}
+	}()
+}
+
+// onScanner runs fn on the scanner and waits for its result
+func onScanner(ctx context.Context, fn func() (interface{}, error)) (interface{}, error) {
+	req := controlRequest{fn: fn, reply: make(chan controlReply, 1)}
+	select {
+	case controlC <- req:
+	case <-ctx.Done():
+		return nil, errors.New("shutting down")
+	}
+	select {
+	case r := <-req.reply:
+		return r.v, r.err
+	case <-ctx.Done():
+		return nil, errors.New("shutting down")
+	}
+}
+
+// run runs the request and replies
+func (req controlRequest) run() {
+	v, err := req.fn()
+	req.reply <- controlReply{v, err}
+}
+
+// decode reads the json body of r into v. an empty body keeps v
+func decode(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil && err != io.EOF {
+		return fmt.Errorf("invalid json: %v", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
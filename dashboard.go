@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/slicken/arbitrager/balance"
+	"github.com/slicken/arbitrager/orderbook"
+	"github.com/slicken/arbitrager/pnl"
+	"github.com/slicken/arbitrager/risk"
+	"github.com/slicken/arbitrager/utils"
+)
+
+const (
+	// dashboardRows is the number of routes, executions and balances shown
+	dashboardRows = 8
+	// dashboardRefresh is how often the dashboard is drawn
+	dashboardRefresh = time.Second
+)
+
+// execution is a finished route shown on the dashboard
+type execution struct {
+	time     time.Time
+	route    string
+	asset    string
+	initial  float64
+	expected float64
+	final    float64
+	err      error
+}
+
+// executions holds the last routes, newest first
+var executions []execution
+
+// recordExecution adds the result of route o to the dashboard
+func recordExecution(o *OrderSet, final float64, err error) {
+	e := execution{
+		time:     time.Now(),
+		route:    o.Name(),
+		asset:    o.asset,
+		initial:  o.initial,
+		expected: o.profit,
+		final:    final,
+		err:      err,
+	}
+	executions = append([]execution{e}, executions...)
+	if len(executions) > dashboardRows {
+		executions = executions[:dashboardRows]
+	}
+}
+
+// dashboard draws the app state in place of the log output.
+// it is drawn from the scanner so it reads books and balances safely
+type dashboard struct {
+	notify *orderbook.Notifier
+	last   time.Time
+	stats  orderbook.NotifyStats
+	msgs   map[string]uint64
+}
+
+func newDashboard(notify *orderbook.Notifier) *dashboard {
+	utils.LogOnlyToFile()
+	utils.Cls()
+	return &dashboard{
+		notify: notify,
+		last:   time.Now(),
+		stats:  notify.Stats(),
+		msgs:   make(map[string]uint64),
+	}
+}
+
+// rate returns n per second since the last draw
+func (d *dashboard) rate(n uint64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(n) / elapsed.Seconds()
+}
+
+// draw writes the dashboard to w, overwriting the previous one
+func (d *dashboard) draw(w io.Writer) {
+	now := time.Now()
+	elapsed := now.Sub(d.last)
+	d.last = now
+
+	var b bytes.Buffer
+	line := func(format string, a ...interface{}) {
+		fmt.Fprintf(&b, format, a...)
+		b.WriteString("\033[K\n")
+	}
+
+	mode := "trading"
+	if scanOnly {
+		mode = "scan only"
+	} else if dryrun {
+		mode = "dry run"
+	}
+	line("%s  %s  %s  up %v  target %.2f%%  size %v  assets %v",
+		appName, E.GetName(), mode, now.Sub(started).Round(time.Second), target, size, assets)
+	line("")
+
+	// streams
+	line("%-20s %-6s %10s %10s %10s", "stream", "status", "since", "reconnects", "msg/s")
+	for _, c := range E.Conns() {
+		ok, since := c.Connected()
+		status := "down"
+		if ok {
+			status = "up"
+		}
+		n := c.Messages()
+		line("%-20s %-6s %10v %10d %10.1f", c.Name, status, since.Round(time.Second), c.Reconnects(), d.rate(n-d.msgs[c.Name], elapsed))
+		d.msgs[c.Name] = n
+	}
+	st := d.notify.Stats()
+	line("book updates %.1f/s, scanned %.1f/s, pending %d, dropped wakeups %d",
+		d.rate(st.Updates-d.stats.Updates, elapsed), d.rate(st.Drained-d.stats.Drained, elapsed), st.Pending, st.Dropped)
+	d.stats = st
+	line("")
+
+	// routes
+	line("%-44s %8s %8s  %s", "route", "profit", "margin", "prices")
+	for _, o := range topRoutes(dashboardRows) {
+		line("%-44s %7.2f%% %7.2f%%  %-12g %-12g %-12g", o.Name(), o.perc, o.margin, o.price[0], o.price[1], o.price[2])
+	}
+	line("opportunities %d, executed %d, failed %d", found, executed, failed)
+	line("")
+
+	// executions
+	line("%-8s %-44s %14s %14s", "time", "route", "expected", "realized")
+	for _, e := range executions {
+		if e.err != nil {
+			line("%-8s %-44s %14f  %v", e.time.Format("15:04:05"), e.route, e.expected, e.err)
+			continue
+		}
+		line("%-8s %-44s %14f %14f (%5.2f%%)", e.time.Format("15:04:05"), e.route, e.expected,
+			e.final-e.initial, (e.final/e.initial)*100-100)
+	}
+	line("")
+
+	// balances
+	line("%-8s %16s %16s %12s", "asset", "free", "locked", "USD")
+	for _, bal := range topBalances(dashboardRows) {
+		line("%-8s %16f %16f %12.2f", bal.Asset, bal.Free, bal.Locked, usdValue(bal.Asset, bal.Free+bal.Locked))
+	}
+	line("")
+
+	// risk
+	l := risk.Limits()
+	today := pnl.Today()
+	if reason, ok := risk.Halted(); ok {
+		line("HALTED: %s", reason)
+	} else if now.Before(lastTrade) {
+		line("cooldown until %s", lastTrade.Format("15:04:05"))
+	} else {
+		line("ready")
+	}
+	line("today %d trades, pnl %f USDT (max loss %v), losses in a row %d/%d, stranded %.2f USD (max %v), max size %v USD",
+		today.Trades, today.PnL, l.MaxDailyLoss, risk.Losses(), l.MaxConsecutiveLosses,
+		pnl.StrandedValue(tickers), l.MaxStranded, l.MaxNotional)
+
+	io.WriteString(w, "\033[H"+b.String()+"\033[J")
+}
+
+// topRoutes returns the n most profitable routes on the current books
+func topRoutes(n int) []*OrderSet {
+	var list []*OrderSet
+	for _, s := range allSets() {
+		if o := s.depthProfits(size); o != nil {
+			o.margin = s.margin()
+			list = append(list, o)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].perc > list[j].perc
+	})
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+// topBalances returns the n largest balances by USD value
+func topBalances(n int) []*balance.Balance {
+	var list []*balance.Balance
+	for _, b := range balance.Balances {
+		if b.Free+b.Locked > 0 {
+			list = append(list, b)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return usdValue(list[i].Asset, list[i].Free+list[i].Locked) > usdValue(list[j].Asset, list[j].Free+list[j].Locked)
+	})
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/slicken/arbitrager/currencie"
+	"github.com/slicken/arbitrager/journal"
+	"github.com/slicken/arbitrager/orderbook"
+	"github.com/slicken/arbitrager/orders"
+)
+
+// dryRunStatus is the status of simulated trades
+const dryRunStatus = "DRY_RUN"
+
+// dataFile returns filename, or a separate file for dry runs
+// so simulated results never mix with real ones
+func dataFile(filename string) string {
+	if !dryrun {
+		return filename
+	}
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "-dryrun" + ext
+}
+
+// sendMarket sends a market order. in dry run mode the order is
+// validated by the exchange and filled from the local book instead
+func sendMarket(req journal.OrderRequest) (*orders.Trade, error) {
+	if !dryrun {
+		return E.SendMarket(req.Pair, req.Side, req.Amount, req.Quote, req.ClientID)
+	}
+	if err := E.TestMarket(req.Pair, req.Side, req.Amount, req.Quote); err != nil {
+		return nil, err
+	}
+	return simulateMarket(req)
+}
+
+// simulateMarket fills req from the local book
+func simulateMarket(req journal.OrderRequest) (*orders.Trade, error) {
+	p, err := E.Pair(req.Pair)
+	if err != nil {
+		return nil, fmt.Errorf("%s not found", req.Pair)
+	}
+	return fillFromBook(p, req)
+}
+
+// fillFromBook fills req by walking the local book of p, paying
+// MAKER_FEE in the received asset
+func fillFromBook(p currencie.Pair, req journal.OrderRequest) (*orders.Trade, error) {
+	book, _ := orderbook.GetBook(p.Name)
+
+	t := &orders.Trade{
+		ClientID: req.ClientID,
+		Pair:     p.Name,
+		Side:     strings.ToUpper(req.Side),
+		Status:   dryRunStatus,
+		Amount:   req.Amount,
+		Quote:    req.Quote,
+		Time:     time.Now(),
+	}
+	isBuy := t.Side == "BUY"
+	levels := book.Bids.Get()
+	if isBuy {
+		levels = book.Asks.Get()
+	}
+
+	// what is left to fill, in quote if a quote amount was given
+	byQuote := req.Quote > 0
+	left := req.Amount
+	if byQuote {
+		left = req.Quote
+	}
+	for _, l := range levels {
+		if left <= 0 {
+			break
+		}
+		qty := l.Amount
+		if byQuote && left < qty*l.Price {
+			qty = left / l.Price
+		} else if !byQuote && left < qty {
+			qty = left
+		}
+		if byQuote {
+			left -= qty * l.Price
+		} else {
+			left -= qty
+		}
+
+		f := orders.Fill{Price: l.Price, Qty: qty, CommissionAsset: p.Quote}
+		received := qty * l.Price
+		if isBuy {
+			f.CommissionAsset = p.Base
+			received = qty
+		}
+		f.Commission = received * MAKER_FEE
+		t.Fills = append(t.Fills, f)
+		t.Filled += qty
+		t.Cost += qty * l.Price
+		t.Received += received - f.Commission
+	}
+	// float leftovers of a fully walked level are not worth failing over
+	if left > 1e-9*(req.Amount+req.Quote) {
+		return nil, fmt.Errorf("%s book too thin to fill %s %f %f", p.Name, req.Side, req.Amount, req.Quote)
+	}
+	if t.Filled > 0 {
+		t.Price = t.Cost / t.Filled
+	}
+	return t, nil
+}
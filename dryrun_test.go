@@ -0,0 +1,127 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/slicken/arbitrager/journal"
+	"github.com/slicken/arbitrager/orderbook"
+)
+
+func TestFillFromBook(t *testing.T) {
+	p := pair("ETH", "BTC")
+	book, _ := orderbook.GetBook(p.Name)
+	book.Reset()
+	// asks 0.05 x 1, 0.051 x 2, 0.052 x 4
+	book.Add(0.05, 1, false)
+	book.Add(0.051, 2, false)
+	book.Add(0.052, 4, false)
+	// bids 0.049 x 1, 0.048 x 3
+	book.Add(0.049, 1, true)
+	book.Add(0.048, 3, true)
+	defer orderbook.Delete(p.Name)
+
+	tests := []struct {
+		name     string
+		req      journal.OrderRequest
+		fills    int
+		filled   float64
+		cost     float64
+		received float64
+		thin     bool
+	}{
+		{
+			name:     "buy within the top level",
+			req:      journal.OrderRequest{Side: "buy", Amount: 0.5},
+			fills:    1,
+			filled:   0.5,
+			cost:     0.025,
+			received: 0.5 * (1 - MAKER_FEE),
+		},
+		{
+			name:     "buy over levels",
+			req:      journal.OrderRequest{Side: "buy", Amount: 2},
+			fills:    2,
+			filled:   2,
+			cost:     0.05 + 0.051,
+			received: 2 * (1 - MAKER_FEE),
+		},
+		{
+			name:     "buy by quote over levels",
+			req:      journal.OrderRequest{Side: "buy", Quote: 0.05 + 0.102 + 0.026},
+			fills:    3,
+			filled:   3.5,
+			cost:     0.178,
+			received: 3.5 * (1 - MAKER_FEE),
+		},
+		{
+			name:     "sell over levels",
+			req:      journal.OrderRequest{Side: "sell", Amount: 3},
+			fills:    2,
+			filled:   3,
+			cost:     0.049 + 2*0.048,
+			received: (0.049 + 2*0.048) * (1 - MAKER_FEE),
+		},
+		{
+			name:     "sell the whole book",
+			req:      journal.OrderRequest{Side: "sell", Amount: 4},
+			fills:    2,
+			filled:   4,
+			cost:     0.049 + 3*0.048,
+			received: (0.049 + 3*0.048) * (1 - MAKER_FEE),
+		},
+		{
+			name: "buy more than the book",
+			req:  journal.OrderRequest{Side: "buy", Amount: 7.5},
+			thin: true,
+		},
+		{
+			name: "sell by quote more than the book",
+			req:  journal.OrderRequest{Side: "sell", Quote: 1},
+			thin: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Pair = p.Name
+			tt.req.ClientID = "arb-1-0"
+			tr, err := fillFromBook(p, tt.req)
+			if tt.thin {
+				if err == nil {
+					t.Fatalf("filled %+v from a thin book, want an error", tr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tr.Fills) != tt.fills {
+				t.Errorf("%d fills, want %d", len(tr.Fills), tt.fills)
+			}
+			if !near(tr.Filled, tt.filled) || !near(tr.Cost, tt.cost) || !near(tr.Received, tt.received) {
+				t.Errorf("filled %f cost %f received %f, want %f %f %f", tr.Filled, tr.Cost, tr.Received, tt.filled, tt.cost, tt.received)
+			}
+			if !near(tr.Price, tt.cost/tt.filled) {
+				t.Errorf("price %f, want %f", tr.Price, tt.cost/tt.filled)
+			}
+			if tr.Status != dryRunStatus || tr.ClientID != "arb-1-0" {
+				t.Errorf("status %s client id %s", tr.Status, tr.ClientID)
+			}
+			// fees are paid in the received asset
+			want := p.Quote
+			if tt.req.Side == "buy" {
+				want = p.Base
+			}
+			for _, f := range tr.Fills {
+				if f.CommissionAsset != want {
+					t.Errorf("commission in %s, want %s", f.CommissionAsset, want)
+				}
+			}
+		})
+	}
+}
+
+// near compares floats within rounding errors
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
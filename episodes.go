@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/slicken/arbitrager/balance"
+	"github.com/slicken/arbitrager/config"
+	"github.com/slicken/arbitrager/episodes"
+)
+
+const episodesFile = "episodes.jsonl"
+
+// trackEpisodes records profits of all sets containing pair name,
+// whether they are traded or not
+func trackEpisodes(name string) {
+	pair, _ := E.Pair(name)
+	for _, set := range SetsMap[pair] {
+		// size 0 trades the free balance, as the scanner does
+		max := size
+		if b, ok := balance.Balances[set.asset]; ok && max <= 0 {
+			max = b.Free * 0.9
+		}
+		var perc, achievable float64
+		found := false
+		for amount := max; amount > 0; amount -= (max / float64(steps)) {
+			o := set.depthProfits(amount)
+			if o == nil {
+				continue
+			}
+			if !found || o.perc > perc {
+				perc = o.perc
+			}
+			found = true
+			if o.perc >= config.Cfg.Episodes.Threshold && amount > achievable {
+				achievable = amount
+			}
+		}
+		if found {
+			episodes.Update(set.Name(), set.asset, perc, achievable)
+		}
+	}
+}
+
+// runEpisodes prints opportunity analytics
+func runEpisodes(args []string) {
+	fs := flag.NewFlagSet("episodes", flag.ExitOnError)
+	file := fs.String("f", episodesFile, "episodes file")
+	from := fs.String("from", "", "from date (YYYYMMDD)")
+	to := fs.String("to", "", "to date (YYYYMMDD), exclusive")
+	top := fs.Int("top", 20, "number of routes to list")
+	fs.Parse(args)
+
+	var t0, t1 time.Time
+	var err error
+	if *from != "" {
+		if t0, err = time.ParseInLocation("20060102", *from, time.Local); err != nil {
+			fmt.Println("invalid -from:", err)
+			os.Exit(1)
+		}
+	}
+	if *to != "" {
+		if t1, err = time.ParseInLocation("20060102", *to, time.Local); err != nil {
+			fmt.Println("invalid -to:", err)
+			os.Exit(1)
+		}
+	}
+
+	list, err := episodes.Read(*file, t0, t1)
+	if err != nil {
+		fmt.Println("could not read episodes:", err)
+		os.Exit(1)
+	}
+	episodes.Report(os.Stdout, list, *top)
+}
@@ -0,0 +1,245 @@
+package episodes
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Episode is a period a route stayed above the threshold
+type Episode struct {
+	Route string    `json:"route"`
+	Asset string    `json:"asset"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Peak is the highest profit in percent
+	Peak float64 `json:"peak"`
+	// Size is the largest amount of Asset above the threshold
+	Size    float64 `json:"size"`
+	Updates int     `json:"updates"`
+}
+
+// Lifetime of the episode
+func (e Episode) Lifetime() time.Duration {
+	return e.End.Sub(e.Start)
+}
+
+var (
+	mu        sync.Mutex
+	file      *os.File
+	threshold float64
+	open      = make(map[string]*Episode)
+)
+
+// Open opens filename for appending and tracks routes above threshold percent
+func Open(filename string, thresh float64) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	file = f
+	threshold = thresh
+	return nil
+}
+
+// Close ends all open episodes and closes the file
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if file == nil {
+		return nil
+	}
+	now := time.Now()
+	for k, e := range open {
+		e.End = now
+		write(e)
+		delete(open, k)
+	}
+	err := file.Close()
+	file = nil
+	return err
+}
+
+// Update records the profit in percent of route after a book update.
+// size is the largest amount of asset above the threshold
+func Update(route, asset string, perc, size float64) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if file == nil {
+		return
+	}
+	now := time.Now()
+	e, ok := open[route]
+	if perc < threshold {
+		if ok {
+			e.End = now
+			write(e)
+			delete(open, route)
+		}
+		return
+	}
+	if !ok {
+		e = &Episode{Route: route, Asset: asset, Start: now}
+		open[route] = e
+	}
+	e.Updates++
+	if perc > e.Peak {
+		e.Peak = perc
+	}
+	if size > e.Size {
+		e.Size = size
+	}
+}
+
+func write(e *Episode) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Println("episodes:", err.Error())
+		return
+	}
+	if _, err := file.Write(append(b, '\n')); err != nil {
+		log.Println("episodes:", err.Error())
+	}
+}
+
+// Read returns all episodes of filename starting between from and to. zero times are ignored
+func Read(filename string, from, to time.Time) ([]Episode, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var list []Episode
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Episode
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if !from.IsZero() && e.Start.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !e.Start.Before(to) {
+			continue
+		}
+		list = append(list, e)
+	}
+	return list, scanner.Err()
+}
+
+// RouteStats holds episodes of one route
+type RouteStats struct {
+	Route  string
+	Count  int
+	PerDay float64
+	Median time.Duration
+	Peak   float64
+	Size   float64
+}
+
+// Buckets are the lower bounds in percent of the peak profit distribution
+var Buckets = []float64{0, 0.5, 1, 2, 5, 10}
+
+// Report writes the top routes by number of episodes, lifetimes
+// and the distribution of peak profits of list to w
+func Report(w io.Writer, list []Episode, top int) {
+	if len(list) == 0 {
+		fmt.Fprintln(w, "no episodes")
+		return
+	}
+
+	first, last := list[0].Start, list[0].End
+	byRoute := make(map[string][]Episode)
+	var lifetimes []time.Duration
+	for _, e := range list {
+		byRoute[e.Route] = append(byRoute[e.Route], e)
+		lifetimes = append(lifetimes, e.Lifetime())
+		if e.Start.Before(first) {
+			first = e.Start
+		}
+		if e.End.After(last) {
+			last = e.End
+		}
+	}
+	days := last.Sub(first).Hours() / 24
+	if days < 1.0/24 {
+		days = 1.0 / 24
+	}
+
+	var routes []RouteStats
+	for name, l := range byRoute {
+		r := RouteStats{Route: name, Count: len(l), PerDay: float64(len(l)) / days}
+		var lt []time.Duration
+		for _, e := range l {
+			lt = append(lt, e.Lifetime())
+			if e.Peak > r.Peak {
+				r.Peak = e.Peak
+			}
+			if e.Size > r.Size {
+				r.Size = e.Size
+			}
+		}
+		r.Median = median(lt)
+		routes = append(routes, r)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Count == routes[j].Count {
+			return routes[i].Peak > routes[j].Peak
+		}
+		return routes[i].Count > routes[j].Count
+	})
+
+	fmt.Fprintf(w, "episodes        %d in %d routes, %s to %s\n", len(list), len(routes),
+		first.Format("2006-01-02 15:04"), last.Format("2006-01-02 15:04"))
+	fmt.Fprintf(w, "median lifetime %v\n", median(lifetimes))
+
+	fmt.Fprintln(w, "\npeak profit")
+	counts := make([]int, len(Buckets))
+	for _, e := range list {
+		for i := len(Buckets) - 1; i >= 0; i-- {
+			if e.Peak >= Buckets[i] {
+				counts[i]++
+				break
+			}
+		}
+	}
+	for i, n := range counts {
+		label := fmt.Sprintf(">= %.1f%%", Buckets[i])
+		if i+1 < len(Buckets) {
+			label = fmt.Sprintf("%.1f-%.1f%%", Buckets[i], Buckets[i+1])
+		}
+		fmt.Fprintf(w, "  %-12s %7d %5.1f%%\n", label, n, float64(n)/float64(len(list))*100)
+	}
+
+	if top > 0 && top < len(routes) {
+		routes = routes[:top]
+	}
+	fmt.Fprintf(w, "\n  %7s %8s %12s %8s %14s  %s\n", "count", "per day", "median", "peak%", "max size", "route")
+	for _, r := range routes {
+		fmt.Fprintf(w, "  %7d %8.1f %12v %8.2f %14f  %s\n", r.Count, r.PerDay, r.Median, r.Peak, r.Size, r.Route)
+	}
+}
+
+func median(list []time.Duration) time.Duration {
+	if len(list) == 0 {
+		return 0
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	n := len(list) / 2
+	if len(list)%2 == 0 {
+		return (list[n-1] + list[n]) / 2
+	}
+	return list[n]
+}
@@ -1,25 +1,26 @@
 package binance
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/slicken/arbitrager/balance"
 	"github.com/slicken/arbitrager/client"
 	"github.com/slicken/arbitrager/config"
 	"github.com/slicken/arbitrager/currencie"
 	"github.com/slicken/arbitrager/exchanges"
+	"github.com/slicken/arbitrager/metrics"
 	"github.com/slicken/arbitrager/orderbook"
 	"github.com/slicken/arbitrager/orders"
 	"github.com/slicken/arbitrager/utils"
@@ -28,7 +29,6 @@ import (
 
 const (
 	apiURL = "https://api.binance.com"
-	wsURL  = "wss://stream.binance.com:9443/ws"
 
 	exchangeInfo = "/api/v1/exchangeInfo"
 	account      = "/api/v3/account"
@@ -36,22 +36,86 @@ const (
 	ticker       = "/api/v3/ticker/price"
 	tickerAll    = "/api/v1/ticker/allPrices"
 	tickerBook   = "/api/v3/ticker/bookTicker"
+	ticker24hr   = "/api/v3/ticker/24hr"
 	newOrder     = "/api/v3/order"
 	newOrderTest = "/api/v3/order/test"
 	trades       = "/api/v3/myTrades"
+	openOrders   = "/api/v3/openOrders"
+	klines       = "/api/v1/klines"
 
-	maxRate = 1200
+	maxRate   = 1200
+	maxOrders = 50
 )
 
+// requestWeight returns weight and order count of a request
+func requestWeight(method, path string) (int, int) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return 1, 0
+	}
+	q := u.Query()
+
+	switch u.Path {
+	case exchangeInfo, account, trades:
+		return 20, 0
+	case depth:
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		switch {
+		case limit <= 100:
+			return 5, 0
+		case limit <= 500:
+			return 25, 0
+		case limit <= 1000:
+			return 50, 0
+		}
+		return 250, 0
+	case ticker, tickerBook:
+		if q.Get("symbol") == "" {
+			return 4, 0
+		}
+		return 2, 0
+	case tickerAll:
+		return 4, 0
+	case ticker24hr:
+		if q.Get("symbol") == "" {
+			return 40, 0
+		}
+		return 1, 0
+	case newOrder:
+		switch method {
+		case "POST":
+			return 1, 1
+		case "GET":
+			return 4, 0
+		}
+		return 1, 0
+	case klines:
+		return 2, 0
+	case openOrders:
+		if q.Get("symbol") == "" {
+			return 40, 0
+		}
+		return 3, 0
+	}
+	return 1, 0
+}
+
 // Binance is exchange wrapper
 type Binance struct {
 	exchanges.Exchange
 	Debug bool
-	// *client.RateLimit
+
+	mux        *streamMux
+	muxOnce    sync.Once
+	clock      clock
+	recvWindow int64
+	quit       chan bool
 }
 
 var info ExchangeInfo
 
+var wsMessages = metrics.NewCounter("arbitrager_ws_messages_total", "websocket messages received by symbol", "symbol")
+
 // Setup takes in exchange configuration and sets params
 func (e *Binance) Init(c config.ExchangeConfig) error {
 	e.Name = c.Name
@@ -59,12 +123,26 @@ func (e *Binance) Init(c config.ExchangeConfig) error {
 	e.Secret = c.Secret
 	e.Pairs = make(map[string]currencie.Pair)
 	e.Requester = client.NewRequester(e.Name, client.NewHTTPClient(client.DefaultHTTPTimeout))
-	e.Requester.Debug = false
-	// test
-	// e.RateLimit = client.NewRateLimit(1200)
+	e.Requester.Debug = e.Debug
+	e.Requester.Weight = requestWeight
+	e.Requester.Classify = classify
+	e.Requester.RateLimit = client.NewRateLimit(
+		&client.Limit{Name: "REQUEST_WEIGHT_MINUTE_1", Header: "X-MBX-USED-WEIGHT-1M", Max: maxRate, Interval: time.Minute},
+		&client.Limit{Name: "ORDERS_SECOND_10", Header: "X-MBX-ORDER-COUNT-10S", Max: maxOrders, Interval: 10 * time.Second, Orders: true},
+		&client.Limit{Name: "ORDERS_DAY_1", Header: "X-MBX-ORDER-COUNT-1D", Max: 160000, Interval: 24 * time.Hour, Orders: true},
+	)
+	e.recvWindow = c.RecvWindow
+	if e.recvWindow == 0 {
+		e.recvWindow = defaultRecvWindow
+	}
 	if err := e.SetPairs(); err != nil {
 		return err
 	}
+	if err := e.SyncTime(); err != nil {
+		return err
+	}
+	e.quit = make(chan bool)
+	go e.syncTime(e.quit)
 	if err := e.UpdateBalance(); err != nil {
 		return err
 	}
@@ -79,6 +157,11 @@ func (e *Binance) SetPairs() error {
 		return err
 	}
 
+	// use the limits binance tells us
+	for _, v := range info.RateLimits {
+		e.RateLimit.SetMax(fmt.Sprintf("%s_%s_%d", v.RateLimitType, v.Interval, v.IntervalNum), v.Limit)
+	}
+
 	e.Pairs = make(map[string]currencie.Pair)
 	for _, v := range info.Symbols {
 		p := currencie.Pair{}
@@ -151,6 +234,13 @@ func (e *Binance) TickerBook(symbol string) (BookTicker, error) {
 	return resp, e.SendHTTPRequest("GET", url, false, &resp)
 }
 
+// Ticker24hrAll returns 24 hour statistics of all symbols
+func (e *Binance) Ticker24hrAll() ([]Ticker24hr, error) {
+	resp := []Ticker24hr{}
+	url := apiURL + ticker24hr
+	return resp, e.SendHTTPRequest("GET", url, false, &resp)
+}
+
 // SendHTTPRequest sends the auth or unauth api request to exchange
 func (e *Binance) SendHTTPRequest(method, url string, auth bool, result interface{}) error {
 	req, err := http.NewRequest(method, url, strings.NewReader(""))
@@ -165,7 +255,8 @@ func (e *Binance) SendHTTPRequest(method, url string, auth bool, result interfac
 		}
 		req.Header.Add("X-MBX-APIKEY", e.Key)
 		q := req.URL.Query()
-		q.Set("timestamp", fmt.Sprintf("%d", time.Now().Unix()*1000))
+		q.Set("timestamp", strconv.FormatInt(e.timestamp(), 10))
+		q.Set("recvWindow", strconv.FormatInt(e.recvWindow, 10))
 		mac := hmac.New(sha256.New, []byte(e.Secret))
 		_, err := mac.Write([]byte(q.Encode()))
 		if err != nil {
@@ -174,7 +265,15 @@ func (e *Binance) SendHTTPRequest(method, url string, auth bool, result interfac
 		signature := hex.EncodeToString(mac.Sum(nil))
 		req.URL.RawQuery = q.Encode() + "&signature=" + signature
 	}
-	return e.Do(req, method, url, auth, &result)
+
+	err = e.Do(req, method, url, auth, &result)
+	if auth && isTimestampError(err) {
+		// the request was rejected, resync before the caller sends it again
+		if serr := e.SyncTime(); serr != nil {
+			log.Printf("%s time sync failed: %v\n", e.Name, serr)
+		}
+	}
+	return err
 }
 
 // GetOrderbook Wrapper updates and returns the orderbook for a currency pair
@@ -231,6 +330,19 @@ func (e *Binance) GetOrderbook(pair string, limit int64) (*orderbook.Book, error
 	return book, nil
 }
 
+// depthSnapshot returns the REST orderbook of symbol with its lastUpdateId
+func (e *Binance) depthSnapshot(symbol string, limit int64) (OrderBookData, error) {
+	resp := OrderBookData{}
+
+	params := url.Values{}
+	params.Set("symbol", symbol)
+	params.Set("limit", strconv.FormatInt(limit, 10))
+
+	url := fmt.Sprintf("%s%s?%s", apiURL, depth, params.Encode())
+	err := e.SendHTTPRequest("GET", url, false, &resp)
+	return resp, err
+}
+
 // CancelOrder cancel an Order
 func (e *Binance) CancelOrder(symbol string, id int64) (CancelOrderResponse, error) {
 	resp := CancelOrderResponse{}
@@ -245,7 +357,7 @@ func (e *Binance) CancelOrder(symbol string, id int64) (CancelOrderResponse, err
 		return resp, err
 	}
 	if resp.Code != 0 {
-		return resp, fmt.Errorf("%v %s", resp.Code, resp.Msg)
+		return resp, e.apiError(resp.Code, resp.Msg)
 	}
 	return resp, nil
 }
@@ -262,6 +374,122 @@ func (e *Binance) CheckOrder(symbol string, id int64) (OrderStatus, error) {
 	return resp, e.SendHTTPRequest("GET", url, true, &resp)
 }
 
+// OpenOrders returns open orders of symbol, or of all symbols if empty
+func (e *Binance) OpenOrders(symbol string) ([]OrderStatus, error) {
+	resp := []OrderStatus{}
+
+	params := url.Values{}
+	if symbol != "" {
+		params.Set("symbol", strings.ToUpper(symbol))
+	}
+
+	url := fmt.Sprintf("%s%s?%s", apiURL, openOrders, params.Encode())
+	return resp, e.SendHTTPRequest("GET", url, true, &resp)
+}
+
+// CheckOrderByClientID checks orderstatus by our client order id
+func (e *Binance) CheckOrderByClientID(symbol, clientID string) (OrderStatus, error) {
+	resp := OrderStatus{}
+
+	params := url.Values{}
+	params.Set("symbol", strings.ToUpper(symbol))
+	params.Set("origClientOrderId", clientID)
+
+	url := fmt.Sprintf("%s%s?%s", apiURL, newOrder, params.Encode())
+	return resp, e.SendHTTPRequest("GET", url, true, &resp)
+}
+
+// OrderTrades returns the fills of an order
+func (e *Binance) OrderTrades(symbol string, id int64) ([]Fill, error) {
+	resp := []MyTrades{}
+
+	params := url.Values{}
+	params.Set("symbol", strings.ToUpper(symbol))
+	params.Set("orderId", strconv.FormatInt(id, 10))
+
+	url := fmt.Sprintf("%s%s?%s", apiURL, trades, params.Encode())
+	if err := e.SendHTTPRequest("GET", url, true, &resp); err != nil {
+		return nil, err
+	}
+
+	var fills []Fill
+	for _, v := range resp {
+		var f Fill
+		f.Price, _ = strconv.ParseFloat(v.Price, 64)
+		f.Qty, _ = strconv.ParseFloat(v.Quantity, 64)
+		f.Commission, _ = strconv.ParseFloat(v.Commmission, 64)
+		f.CommissionAsset = v.CommissionAsset
+		fills = append(fills, f)
+	}
+	return fills, nil
+}
+
+// recoverWindow is how long recoverOrder looks for an order
+var recoverWindow = 5 * time.Second
+
+// findOrder returns the order of clientID with its fills
+func (e *Binance) findOrder(symbol, clientID string) (NewOrderResponse, error) {
+	resp := NewOrderResponse{}
+
+	st, err := e.CheckOrderByClientID(symbol, clientID)
+	if err != nil {
+		return resp, err
+	}
+	resp.Symbol = st.Symbol
+	resp.OrderID = st.OrderId
+	resp.ClientOrderID = st.ClientOrderId
+	resp.Price = st.Price
+	resp.OrigQty = st.OrigQty
+	resp.ExecutedQty = st.ExecutedQty
+	resp.Status = st.Status
+	resp.Type = st.Type
+	resp.Side = st.Side
+	resp.Fills, err = e.OrderTrades(symbol, st.OrderId)
+	return resp, err
+}
+
+// recoverOrder finds out if an order with an unknown outcome was placed.
+// a lookup right after a timeout can miss an order that was placed, and a
+// filled order does not block its client id, so find is polled for recoverWindow.
+// it returns the order if it was found, or a fatal ErrOrderUnknown if not,
+// so the order is never sent again. an order that ended without fills is a
+// fatal error too, nothing was traded
+func (e *Binance) recoverOrder(clientID string, cause error, find func() (NewOrderResponse, error)) (NewOrderResponse, error) {
+	var resp NewOrderResponse
+	var err error
+	delay := 200 * time.Millisecond
+	deadline := time.Now().Add(recoverWindow)
+	for {
+		if resp, err = find(); err == nil {
+			break
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return resp, &client.Error{
+				Exchange: e.Name,
+				Class:    client.Fatal,
+				Err:      fmt.Errorf("%w: order %s not found within %v of %v, last lookup: %v", client.ErrOrderUnknown, clientID, recoverWindow, cause, err),
+			}
+		}
+		time.Sleep(delay)
+		if delay < time.Second {
+			delay *= 2
+		}
+	}
+
+	switch resp.Status {
+	case "CANCELED", "REJECTED", "EXPIRED":
+		if resp.ExecutedQty == 0 {
+			return resp, &client.Error{
+				Exchange: e.Name,
+				Class:    client.Fatal,
+				Err:      fmt.Errorf("order %s %s without fills after: %v", clientID, strings.ToLower(resp.Status), cause),
+			}
+		}
+	}
+	log.Printf("%s order %s recovered after: %v\n", e.Name, clientID, cause)
+	return resp, nil
+}
+
 // NewOrder sends a new order to Binance
 func (e *Binance) NewOrder(o NewOrderRequest) (NewOrderResponse, error) {
 	resp := NewOrderResponse{}
@@ -283,6 +511,9 @@ func (e *Binance) NewOrder(o NewOrderRequest) (NewOrderResponse, error) {
 	if o.StopPrice != 0 {
 		params.Set("stopPrice", strconv.FormatFloat(o.StopPrice, 'f', -1, 64))
 	}
+	if o.NewClientOrderID != "" {
+		params.Set("newClientOrderId", o.NewClientOrderID)
+	}
 
 	url := fmt.Sprintf("%s%s?%s", apiURL, newOrder, params.Encode())
 	err := e.SendHTTPRequest("POST", url, true, &resp)
@@ -290,12 +521,12 @@ func (e *Binance) NewOrder(o NewOrderRequest) (NewOrderResponse, error) {
 		return resp, err
 	}
 	if resp.Code != 0 {
-		return resp, fmt.Errorf("%v %s", resp.Code, resp.Msg)
+		return resp, e.apiError(resp.Code, resp.Msg)
 	}
 	return resp, nil
 }
 
-// NewOrder sends a new order to Binance
+// NewOrderTest validates a new order without sending it to the matching engine
 func (e *Binance) NewOrderTest(o NewOrderRequest) (NewOrderResponse, error) {
 	resp := NewOrderResponse{}
 
@@ -307,17 +538,18 @@ func (e *Binance) NewOrderTest(o NewOrderRequest) (NewOrderResponse, error) {
 		params.Set("timeInForce", o.TimeInForce)
 		params.Set("price", strconv.FormatFloat(o.Price, 'f', -1, 64))
 	}
-	if o.QuoteQuantity != 0 {
-		params.Set("quoteOrderQty", strconv.FormatFloat(o.QuoteQuantity, 'f', -1, 64))
-		fmt.Printf("o.QuoteQuantity %s\n", params.Get("quoteOrderQty"))
-	}
 	if o.Quantity != 0 {
 		params.Set("quantity", strconv.FormatFloat(o.Quantity, 'f', -1, 64))
-		fmt.Printf("o.quantity %s\n", params.Get("quantity"))
+	}
+	if o.QuoteQuantity != 0 {
+		params.Set("quoteOrderQty", strconv.FormatFloat(o.QuoteQuantity, 'f', -1, 64))
 	}
 	if o.StopPrice != 0 {
 		params.Set("stopPrice", strconv.FormatFloat(o.StopPrice, 'f', -1, 64))
 	}
+	if o.NewClientOrderID != "" {
+		params.Set("newClientOrderId", o.NewClientOrderID)
+	}
 
 	url := fmt.Sprintf("%s%s?%s", apiURL, newOrderTest, params.Encode())
 	err := e.SendHTTPRequest("POST", url, true, &resp)
@@ -325,15 +557,16 @@ func (e *Binance) NewOrderTest(o NewOrderRequest) (NewOrderResponse, error) {
 		return resp, err
 	}
 	if resp.Code != 0 {
-		return resp, fmt.Errorf("%v %s", resp.Code, resp.Msg)
+		return resp, e.apiError(resp.Code, resp.Msg)
 	}
 	return resp, nil
 }
 
 // Wrappers to Exchange Interface -------------------------------------------------------------------------------------------------------------
 
-// SendLimit Wrapper returns exchange pairs orderbook. Downloads if dont have any
-func (e *Binance) SendLimit(pair, side string, amount, price float64) error {
+// SendLimit Wrapper sends a limit order. clientID identifies the order,
+// so its outcome can be recovered after a timeout
+func (e *Binance) SendLimit(pair, side string, amount, price float64, clientID string) error {
 	sym, err := e.Pair(pair)
 	if err != nil {
 		return fmt.Errorf("%s not found", pair)
@@ -342,15 +575,25 @@ func (e *Binance) SendLimit(pair, side string, amount, price float64) error {
 	if i < 0 {
 		return fmt.Errorf("%s info not found", sym.Name)
 	}
+	if clientID == "" {
+		return fmt.Errorf("%s order without client order id", sym.Name)
+	}
 
-	resp, err := e.NewOrder(NewOrderRequest{
-		Symbol:      sym.Name,
-		Side:        strings.ToUpper(side),
-		TradeType:   "LIMIT",
-		Quantity:    utils.FloatImitate(amount, info.Symbols[i].Filters[2].StepSize),
-		Price:       utils.RoundPlus(price, utils.CountDecimal(info.Symbols[i].Filters[0].TickSize)),
-		TimeInForce: "GTC",
-	})
+	req := NewOrderRequest{
+		Symbol:           sym.Name,
+		Side:             strings.ToUpper(side),
+		TradeType:        "LIMIT",
+		Quantity:         utils.FloatImitate(amount, info.Symbols[i].Filters[2].StepSize),
+		Price:            utils.RoundPlus(price, utils.CountDecimal(info.Symbols[i].Filters[0].TickSize)),
+		TimeInForce:      "GTC",
+		NewClientOrderID: clientID,
+	}
+	resp, err := e.NewOrder(req)
+	if unknownOutcome(err) {
+		resp, err = e.recoverOrder(clientID, err, func() (NewOrderResponse, error) {
+			return e.findOrder(sym.Name, clientID)
+		})
+	}
 	if err != nil {
 		return err
 	}
@@ -358,65 +601,92 @@ func (e *Binance) SendLimit(pair, side string, amount, price float64) error {
 	return nil
 }
 
-// SendMarket Wrapper returns marketorder
-func (e *Binance) SendMarket(pair, side string, amount, quoteAmount float64) (float64, error) {
+// SendMarket Wrapper returns marketorder. clientID identifies the order,
+// so its outcome can be recovered after a timeout
+func (e *Binance) SendMarket(pair, side string, amount, quoteAmount float64, clientID string) (*orders.Trade, error) {
 	sym, err := e.Pair(pair)
 	if err != nil {
-		return 0, fmt.Errorf("%s not found", pair)
+		return nil, fmt.Errorf("%s not found", pair)
 	}
 	i := getInfoIndex(sym.Name)
 	if i < 0 {
-		return 0, fmt.Errorf("%s info not found", sym.Name)
+		return nil, fmt.Errorf("%s info not found", sym.Name)
+	}
+
+	if clientID == "" {
+		return nil, fmt.Errorf("%s order without client order id", sym.Name)
 	}
 
 	var resp NewOrderResponse
 	resp, err = e.NewOrder(NewOrderRequest{
-		Symbol:        sym.Name,
-		Side:          strings.ToUpper(side),
-		TradeType:     "MARKET",
-		Quantity:      utils.FloatImitate(amount, info.Symbols[i].Filters[2].StepSize),
-		QuoteQuantity: utils.FloatImitate(quoteAmount, info.Symbols[i].Filters[2].StepSize),
+		Symbol:           sym.Name,
+		Side:             strings.ToUpper(side),
+		TradeType:        "MARKET",
+		Quantity:         utils.FloatImitate(amount, info.Symbols[i].Filters[2].StepSize),
+		QuoteQuantity:    utils.FloatImitate(quoteAmount, info.Symbols[i].Filters[2].StepSize),
+		NewClientOrderID: clientID,
 	})
+	if unknownOutcome(err) {
+		resp, err = e.recoverOrder(clientID, err, func() (NewOrderResponse, error) {
+			return e.findOrder(sym.Name, clientID)
+		})
+	}
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	var qty float64
+	trade := &orders.Trade{
+		ID:       resp.OrderID,
+		ClientID: resp.ClientOrderID,
+		Pair:     sym.Name,
+		Side:     resp.Side,
+		Status:   resp.Status,
+		Amount:   amount,
+		Quote:    quoteAmount,
+		Time:     time.Now(),
+	}
 	for _, v := range resp.Fills {
+		trade.Fills = append(trade.Fills, orders.Fill(v))
+		trade.Filled += v.Qty
+		trade.Cost += v.Price * v.Qty
 		if resp.Side == "BUY" {
-			qty += v.Qty
+			trade.Received += v.Qty
 			if v.CommissionAsset == sym.Base {
-				qty -= v.Commission
+				trade.Received -= v.Commission
 			}
 		} else {
-			qty += (v.Price * v.Qty)
+			trade.Received += (v.Price * v.Qty)
 			if v.CommissionAsset == sym.Quote {
-				qty -= v.Commission
+				trade.Received -= v.Commission
 			}
 		}
 	}
+	if trade.Filled > 0 {
+		trade.Price = trade.Cost / trade.Filled
+	}
 
-	return qty, nil
-
-	// var qty, newQty, comm, test float64
-	// for _, v := range resp.Fills {
-	// 	qty += v.Qty
-	// 	newQty += (v.Price * v.Qty)
-	// 	comm += v.Commission
-	// }
-
-	// if resp.Side == "SELL" {
-	// 	newQty -= comm
-	// 	qty = newQty
-	// }
+	return trade, nil
+}
 
-	// fmt.Printf("qty\t %.8f\n", qty)
-	// fmt.Printf("comm\t %.8f\n", comm)
-	// // if buy .. it costs ->
-	// fmt.Printf("newQty\t %.8f\n", newQty)
+// TestMarket Wrapper validates a market order without sending it to the matching engine
+func (e *Binance) TestMarket(pair, side string, amount, quoteAmount float64) error {
+	sym, err := e.Pair(pair)
+	if err != nil {
+		return fmt.Errorf("%s not found", pair)
+	}
+	i := getInfoIndex(sym.Name)
+	if i < 0 {
+		return fmt.Errorf("%s info not found", sym.Name)
+	}
 
-	// fmt.Printf("test\t %.8f\n", test)
-	// return qty, nil
+	_, err = e.NewOrderTest(NewOrderRequest{
+		Symbol:        sym.Name,
+		Side:          strings.ToUpper(side),
+		TradeType:     "MARKET",
+		Quantity:      utils.FloatImitate(amount, info.Symbols[i].Filters[2].StepSize),
+		QuoteQuantity: utils.FloatImitate(quoteAmount, info.Symbols[i].Filters[2].StepSize),
+	})
+	return err
 }
 
 // SendCancel Wrapper canceles a order and removes from memory
@@ -433,51 +703,35 @@ func (e *Binance) SendCancel(pair string, id int64) error {
 	// return nil
 
 	_, err = e.CancelOrder(sym.Name, id)
-	if err == nil || strings.Contains(fmt.Sprintf("%s", err), "-2011") || strings.Contains(fmt.Sprintf("%s", err), "-2013") {
+	if err == nil || client.ClassOf(err) == client.UnknownOrder {
 		orders.Delete(id)
 	}
 	return err
 }
 
+// streamMux returns the combined stream multiplexer, created on first use
+func (e *Binance) streamMux(ctx context.Context) *streamMux {
+	e.muxOnce.Do(func() {
+		e.mux = newStreamMux(ctx, wsStreamURL)
+	})
+	return e.mux
+}
+
 // StreamBookDepth subscribes to symbols orderbooks and stream the top level depths
-func (e *Binance) StreamBookDepth(pair string, doneC <-chan bool, notifyC chan<- string) error {
+func (e *Binance) StreamBookDepth(ctx context.Context, pair string, notify *orderbook.Notifier) error {
 	sym, err := e.Pair(pair)
 	if err != nil {
 		return fmt.Errorf("%s not found\n", pair)
 	}
 
-	url := fmt.Sprintf(wsURL+"/ws/%s@depth20@100ms", strings.ToLower(sym.Name))
-	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
-	if err != nil {
-		return fmt.Errorf("dial: %v\n", err)
-	}
-
-	defer func() {
-		orderbook.Delete(pair)
-		ws.Close()
-	}()
-
 	book, _ := orderbook.GetBook(sym.Name)
 
-	for {
-		select {
-		case <-doneC:
-			break
-		default:
-		}
-
-		_, b, err := ws.ReadMessage()
-		if err != nil {
-			log.Printf("reconnecting %s due to: %v\n", sym.Name, err.Error())
-			orderbook.Delete(sym.Name)
-			go e.StreamBookDepth(sym.Name, doneC, notifyC)
-			break
-		}
-
+	e.streamMux(ctx).Subscribe(strings.ToLower(sym.Name)+"@depth20@100ms", func(b []byte) {
+		wsMessages.Inc(sym.Name)
 		var resp DepthResponse
 		if err := json.Unmarshal(b, &resp); err != nil {
 			log.Println(err.Error())
-			continue
+			return
 		}
 
 		book.Reset()
@@ -485,87 +739,84 @@ func (e *Binance) StreamBookDepth(pair string, doneC <-chan bool, notifyC chan<-
 			p, _ := strconv.ParseFloat(v[0].(string), 64)
 			a, _ := strconv.ParseFloat(v[1].(string), 64)
 			book.Asks.Add(p, a)
-			// book.Add(p, a, false)
 		}
 		for _, v := range resp.Bids {
 			p, _ := strconv.ParseFloat(v[0].(string), 64)
 			a, _ := strconv.ParseFloat(v[1].(string), 64)
 			book.Bids.Add(p, a)
-			// book.Add(p, a, true)
 		}
-		// if e.Debug {
-		// 	fmt.Printf("%-12s %-12d %-12d\n", sym.Name, len(book.Asks), len(book.Bids))
-		// }
-		notifyC <- sym.Name
-	}
+		notify.Notify(sym.Name)
+	}, book.Reset)
 
 	return nil
 }
 
+// snapshotDepth levels are loaded to start a diff book. 100 levels weigh 5,
+// 1000 levels weigh 50 and all books load again after a reconnect
+const snapshotDepth = 100
+
 // SteamBookDeff stream only the new entry diffs made to orderbook
-func (e *Binance) StreamBookDiff(pair string, done <-chan bool, notifyCh chan<- string) error {
+func (e *Binance) StreamBookDiff(ctx context.Context, pair string, notify *orderbook.Notifier) error {
 	sym, err := e.Pair(pair)
 	if err != nil {
 		return fmt.Errorf("%s not found\n", pair)
 	}
 
-	url := fmt.Sprintf(wsURL+"/%s@depth", strings.ToLower(sym.Name))
-	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
-	if err != nil {
-		return fmt.Errorf("dial: %v\n", err)
-	}
+	book, _ := orderbook.GetBook(sym.Name)
+	d := newDiffBook(book, func() (OrderBookData, error) {
+		return e.depthSnapshot(sym.Name, snapshotDepth)
+	}, func() {
+		notify.Notify(sym.Name)
+	})
+
+	e.streamMux(ctx).Subscribe(strings.ToLower(sym.Name)+"@depth", func(b []byte) {
+		wsMessages.Inc(sym.Name)
+		var resp DepthEvent
+		if err := json.Unmarshal(b, &resp); err != nil {
+			log.Println(err.Error())
+			return
+		}
+		d.update(resp)
+	}, d.reset)
 	log.Printf("subscribed to %s %s orderbook\n", e.Name, sym.Name)
 
-	go func() {
-		defer func() {
-			orderbook.Delete(pair)
-			ws.Close()
-		}()
-
-		for {
-			select {
-			case <-done:
-				break
-			default:
-			}
+	return nil
+}
 
-			_, b, err := ws.ReadMessage()
-			if err != nil {
-				log.Printf("ws error %s: %v\n", pair, err.Error())
-				break
-			}
-			resp := struct {
-				Type     string          `json:"e"`
-				Time     float64         `json:"E"`
-				Symbol   string          `json:"s"`
-				UpdateID int             `json:"u"`
-				Bids     [][]interface{} `json:"b"`
-				Asks     [][]interface{} `json:"a"`
-			}{}
-
-			if err := json.Unmarshal(b, &resp); err != nil {
-				log.Println(err.Error())
-				continue
-			}
+// Unsubscribe stops all orderbook streams of pair and deletes its book
+func (e *Binance) Unsubscribe(pair string) error {
+	sym, err := e.Pair(pair)
+	if err != nil {
+		return fmt.Errorf("%s not found", pair)
+	}
+	if e.mux == nil {
+		return nil
+	}
 
-			book, _ := orderbook.GetBook(resp.Symbol)
-			// book.LastUpdated = time.Now()
-			for _, v := range resp.Asks {
-				p, _ := strconv.ParseFloat(v[0].(string), 64)
-				a, _ := strconv.ParseFloat(v[1].(string), 64)
-				// book.Asks.Add(p, a)
-				book.Add(p, a, false)
-			}
-			for _, v := range resp.Bids {
-				p, _ := strconv.ParseFloat(v[0].(string), 64)
-				a, _ := strconv.ParseFloat(v[1].(string), 64)
-				// book.Bids.Add(p, a)
-				book.Add(p, a, true)
-			}
-			notifyCh <- resp.Symbol
-		}
-	}()
+	name := strings.ToLower(sym.Name)
+	e.mux.Unsubscribe(name + "@depth20@100ms")
+	e.mux.Unsubscribe(name + "@depth")
+	orderbook.Delete(sym.Name)
+	return nil
+}
+
+// Conns returns the stream connections
+func (e *Binance) Conns() []*client.WsConn {
+	if e.mux == nil {
+		return nil
+	}
+	return e.mux.Conns()
+}
 
+// Close closes all streams and waits for the connections to finish
+func (e *Binance) Close() error {
+	if e.quit != nil {
+		close(e.quit)
+		e.quit = nil
+	}
+	if e.mux != nil {
+		e.mux.Close()
+	}
 	return nil
 }
 
@@ -582,6 +833,19 @@ func (e *Binance) GetAllTickers() (map[string]float64, error) {
 	return m, nil
 }
 
+// GetVolumes returns 24 hour quote volume of all pairs
+func (e *Binance) GetVolumes() (map[string]float64, error) {
+	resp, err := e.Ticker24hrAll()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]float64)
+	for _, v := range resp {
+		m[v.Symbol] = v.QuoteVolume
+	}
+	return m, nil
+}
+
 // GetTicker returns price for specifik symbol
 func (e *Binance) GetTicker(pair string) (float64, error) {
 	sym, err := e.Pair(pair)
@@ -596,6 +860,43 @@ func (e *Binance) GetTicker(pair string) (float64, error) {
 	return resp.Price, nil
 }
 
+// GetBookTicker returns best bid and ask price of pair
+func (e *Binance) GetBookTicker(pair string) (bid, ask float64, err error) {
+	sym, err := e.Pair(pair)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s not found", pair)
+	}
+
+	resp, err := e.TickerBook(sym.Name)
+	if err != nil {
+		return 0, 0, err
+	}
+	return resp.BidPrice, resp.AskPrice, nil
+}
+
+// GetOpenOrders Wrapper returns open orders of all pairs
+func (e *Binance) GetOpenOrders() ([]*orders.Order, error) {
+	resp, err := e.OpenOrders("")
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*orders.Order
+	for _, v := range resp {
+		list = append(list, &orders.Order{
+			ID:     v.OrderId,
+			Pair:   v.Symbol,
+			Time:   time.Unix(0, v.Time*int64(time.Millisecond)),
+			Side:   v.Side,
+			Amount: v.OrigQty,
+			Filled: v.ExecutedQty,
+			Price:  v.Price,
+			Stop:   v.StopPrice,
+		})
+	}
+	return list, nil
+}
+
 // OrderStatus Wrapper checks if order exist
 func (e *Binance) OrderStatus(id int64) (string, error) {
 	o := orders.Orders[id]
@@ -660,21 +961,12 @@ func (e *Binance) UpdatePairs() error {
 // GetKlines new data from Binance exchange
 func (e *Binance) GetKlines(symbol, timeframe string, limit int) (history.Bars, error) {
 	path := fmt.Sprintf(
-		"https://api.binance.com/api/v1/klines?symbol=%s&interval=%s&limit=%v",
-		strings.ToUpper(symbol), strings.ToLower(timeframe), limit)
-
-	req, _ := http.NewRequest("GET", path, nil)
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	data, _ := ioutil.ReadAll(resp.Body)
+		"%s%s?symbol=%s&interval=%s&limit=%v",
+		apiURL, klines, strings.ToUpper(symbol), strings.ToLower(timeframe), limit)
 
 	tmp := [][]interface{}{}
-	if err = json.Unmarshal(data, &tmp); err != nil {
+	err := e.SendHTTPRequest("GET", path, false, &tmp)
+	if err != nil {
 		return nil, err
 	}
 
@@ -787,36 +1079,3 @@ func (e *Binance) LastTrade(symbol string, limit int64) (float64, float64, float
 
 	return price, amount, qqty, fee, nil
 }
-
-// func keepAlive(c *websocket.Conn, timeout time.Duration) {
-// 	ticker := time.NewTicker(timeout)
-
-// 	lastResponse := time.Now()
-// 	c.SetPongHandler(func(msg string) error {
-// 		lastResponse = time.Now()
-// 		return nil
-// 	})
-
-// 	for {
-// 		select {
-// 		case <-shutdown:
-// 			return
-
-// 		case <-ticker.C:
-// 			if time.Since(lastResponse) > timeout {
-// 				log.Println("keepAlive timeout. closing.")
-// 				c.Close()
-// 				return
-// 			}
-// 			deadline := time.Now().Add(10 * time.Second)
-// 			err := c.WriteControl(websocket.PingMessage, []byte{}, deadline)
-// 			if err != nil {
-// 				log.Println("keepAlive ERROR:", err.Error())
-// 				c.Close()
-// 				return
-// 			}
-
-// 		default:
-// 		}
-// 	}
-// }
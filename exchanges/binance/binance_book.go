@@ -0,0 +1,196 @@
+package binance
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/slicken/arbitrager/client"
+	"github.com/slicken/arbitrager/logger"
+	"github.com/slicken/arbitrager/orderbook"
+)
+
+// diffBook keeps a book of a diff stream in sequence with a REST snapshot.
+// diffs are buffered while the snapshot loads, diffs older than the snapshot
+// are dropped and a gap in update ids loads a new snapshot
+type diffBook struct {
+	book     *orderbook.Book
+	snapshot func() (OrderBookData, error)
+	notify   func()
+
+	mu sync.Mutex
+	// lastID is u of the last applied diff, or lastUpdateId of the snapshot
+	lastID  int64
+	synced  bool
+	first   bool
+	loading bool
+	// gen tells a load apart from one started before a reset
+	gen    int
+	buffer []DepthEvent
+}
+
+// maxBuffered diffs are kept while a snapshot loads
+const maxBuffered = 1000
+
+// snapshotRetry is the wait before a rate limited snapshot is loaded again,
+// if the limiter does not tell how long
+var snapshotRetry = 2 * time.Second
+
+func newDiffBook(book *orderbook.Book, snapshot func() (OrderBookData, error), notify func()) *diffBook {
+	return &diffBook{book: book, snapshot: snapshot, notify: notify}
+}
+
+// update applies ev, or buffers it and loads a snapshot if the book is not in sequence
+func (d *diffBook) update(ev DepthEvent) {
+	d.mu.Lock()
+	if !d.synced {
+		d.buffer = append(d.buffer, ev)
+		if len(d.buffer) > maxBuffered {
+			d.buffer = d.buffer[len(d.buffer)-maxBuffered:]
+		}
+		d.startLoad()
+		d.mu.Unlock()
+		return
+	}
+	ok := d.apply(ev)
+	if !ok {
+		streamLog.Warn("diff gap, reloading book", "symbol", d.book.Name, "expected", d.lastID+1, "first", ev.FirstUpdateID, "last", ev.LastUpdateID)
+		d.resync()
+		d.buffer = append(d.buffer, ev)
+		d.startLoad()
+	}
+	d.mu.Unlock()
+
+	if ok {
+		d.notify()
+	}
+}
+
+// reset drops the book until a new snapshot is loaded
+func (d *diffBook) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.resync()
+}
+
+// resync must be called with mu locked
+func (d *diffBook) resync() {
+	d.book.Reset()
+	d.synced = false
+	d.loading = false
+	d.gen++
+	d.buffer = nil
+}
+
+// startLoad loads a snapshot in the background. must be called with mu locked
+func (d *diffBook) startLoad() {
+	if d.loading {
+		return
+	}
+	d.loading = true
+	go d.load(d.gen)
+}
+
+func (d *diffBook) load(gen int) {
+	snap, err := d.snapshot()
+	// after a reconnect every book loads at once. the rate limited ones wait
+	// for the limiter, instead of trying again on each diff
+	for client.ClassOf(err) == client.RateLimited {
+		wait := client.RetryAfter(err)
+		if wait == 0 {
+			wait = snapshotRetry
+		}
+		streamLog.Debug("snapshot rate limited", "symbol", d.book.Name, "wait_ms", logger.Millis(wait))
+		time.Sleep(wait)
+
+		d.mu.Lock()
+		stale := gen != d.gen
+		d.mu.Unlock()
+		if stale {
+			return
+		}
+		snap, err = d.snapshot()
+	}
+
+	d.mu.Lock()
+	if gen != d.gen {
+		// reset while loading
+		d.mu.Unlock()
+		return
+	}
+	d.loading = false
+	if err != nil {
+		streamLog.Warn("snapshot failed", "symbol", d.book.Name, "err", err)
+		// the next diff tries again
+		d.mu.Unlock()
+		return
+	}
+	d.book.Reset()
+	addLevels(d.book, snap.Asks, false)
+	addLevels(d.book, snap.Bids, true)
+	d.lastID = snap.LastUpdateID
+	d.synced = true
+	d.first = true
+
+	buffer := d.buffer
+	d.buffer = nil
+	for _, ev := range buffer {
+		if !d.apply(ev) {
+			streamLog.Warn("diff gap after snapshot, reloading book", "symbol", d.book.Name, "snapshot", snap.LastUpdateID)
+			d.resync()
+			d.startLoad()
+			d.mu.Unlock()
+			return
+		}
+	}
+	d.mu.Unlock()
+
+	d.notify()
+}
+
+// apply adds ev to the book if it follows lastID. it returns false on a gap.
+// must be called with mu locked
+func (d *diffBook) apply(ev DepthEvent) bool {
+	if ev.LastUpdateID <= d.lastID {
+		// older than the book
+		return true
+	}
+	if d.first {
+		// the first diff after a snapshot must contain lastUpdateId+1
+		if ev.FirstUpdateID > d.lastID+1 {
+			return false
+		}
+		d.first = false
+	} else if ev.FirstUpdateID != d.lastID+1 {
+		return false
+	}
+
+	for _, v := range ev.Asks {
+		p, _ := strconv.ParseFloat(v[0].(string), 64)
+		a, _ := strconv.ParseFloat(v[1].(string), 64)
+		d.book.Add(p, a, false)
+	}
+	for _, v := range ev.Bids {
+		p, _ := strconv.ParseFloat(v[0].(string), 64)
+		a, _ := strconv.ParseFloat(v[1].(string), 64)
+		d.book.Add(p, a, true)
+	}
+	d.lastID = ev.LastUpdateID
+	return true
+}
+
+// addLevels adds [price, amount] levels of a REST depth response to book
+func addLevels(book *orderbook.Book, levels []interface{}, bid bool) {
+	for _, l := range levels {
+		v, ok := l.([]interface{})
+		if !ok || len(v) < 2 {
+			continue
+		}
+		ps, _ := v[0].(string)
+		as, _ := v[1].(string)
+		p, _ := strconv.ParseFloat(ps, 64)
+		a, _ := strconv.ParseFloat(as, 64)
+		book.Add(p, a, bid)
+	}
+}
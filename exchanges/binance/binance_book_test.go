@@ -0,0 +1,263 @@
+package binance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/slicken/arbitrager/client"
+	"github.com/slicken/arbitrager/orderbook"
+)
+
+// diff returns a depth event of update ids first-last with one ask
+func diff(first, last int64, price, amount string) DepthEvent {
+	return DepthEvent{FirstUpdateID: first, LastUpdateID: last, Asks: [][]interface{}{{price, amount}}}
+}
+
+// snapshot returns a depth snapshot with one ask
+func snapshot(id int64, price, amount string) OrderBookData {
+	return OrderBookData{LastUpdateID: id, Asks: []interface{}{[]interface{}{price, amount}}}
+}
+
+// asks returns price:amount of the asks of book
+func asks(book *orderbook.Book) string {
+	var s []string
+	for _, v := range book.Snapshot(orderbook.DEPTH).Asks {
+		s = append(s, fmt.Sprintf("%g:%g", v.Price, v.Amount))
+	}
+	return strings.Join(s, " ")
+}
+
+// waitFor polls fn until it is true
+func waitFor(t *testing.T, what string, fn func() bool) {
+	t.Helper()
+	for end := time.Now().Add(3 * time.Second); time.Now().Before(end); time.Sleep(5 * time.Millisecond) {
+		if fn() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestDiffBookSequence(t *testing.T) {
+	tests := []struct {
+		name      string
+		snapshots []OrderBookData
+		before    []DepthEvent // buffered while the first snapshot loads
+		after     []DepthEvent
+		want      string
+		loads     int
+	}{
+		{
+			name:      "drops diffs older than the snapshot",
+			snapshots: []OrderBookData{snapshot(100, "1", "5")},
+			before:    []DepthEvent{diff(90, 95, "1", "9"), diff(96, 101, "2", "1")},
+			after:     []DepthEvent{diff(102, 103, "3", "1")},
+			want:      "1:5 2:1 3:1",
+			loads:     1,
+		},
+		{
+			name:      "first diff straddles the snapshot",
+			snapshots: []OrderBookData{snapshot(100, "1", "5")},
+			before:    []DepthEvent{diff(99, 102, "1", "0")},
+			after:     []DepthEvent{diff(103, 103, "2", "2")},
+			want:      "2:2",
+			loads:     1,
+		},
+		{
+			name:      "gap loads a new snapshot",
+			snapshots: []OrderBookData{snapshot(100, "1", "5"), snapshot(200, "4", "4")},
+			before:    []DepthEvent{diff(101, 101, "2", "1")},
+			after:     []DepthEvent{diff(105, 106, "3", "1"), diff(201, 201, "5", "5")},
+			want:      "4:4 5:5",
+			loads:     2,
+		},
+		{
+			name:      "first diff after the snapshot is missing",
+			snapshots: []OrderBookData{snapshot(100, "1", "5"), snapshot(110, "6", "6")},
+			before:    []DepthEvent{diff(103, 104, "2", "1")},
+			after:     []DepthEvent{diff(111, 111, "7", "7")},
+			want:      "6:6 7:7",
+			loads:     2,
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book, _ := orderbook.GetBook(fmt.Sprintf("SEQ%dUSDT", i))
+			var mu sync.Mutex
+			loads := 0
+			release := make(chan bool)
+			d := newDiffBook(book, func() (OrderBookData, error) {
+				// the first snapshot waits for the buffered diffs
+				<-release
+				mu.Lock()
+				defer mu.Unlock()
+				s := tt.snapshots[loads]
+				loads++
+				return s, nil
+			}, func() {})
+
+			for _, ev := range tt.before {
+				d.update(ev)
+			}
+			close(release)
+			waitFor(t, "snapshot", func() bool {
+				d.mu.Lock()
+				defer d.mu.Unlock()
+				return d.synced
+			})
+			for _, ev := range tt.after {
+				d.update(ev)
+				waitFor(t, "sync", func() bool {
+					d.mu.Lock()
+					defer d.mu.Unlock()
+					return d.synced
+				})
+			}
+			if got := asks(book); got != tt.want {
+				t.Errorf("asks %q, want %q", got, tt.want)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if loads != tt.loads {
+				t.Errorf("%d snapshots loaded, want %d", loads, tt.loads)
+			}
+		})
+	}
+}
+
+func TestDiffBookRateLimitedSnapshot(t *testing.T) {
+	defer func(d time.Duration) { snapshotRetry = d }(snapshotRetry)
+	snapshotRetry = 10 * time.Millisecond
+
+	book, _ := orderbook.GetBook("LIMITUSDT")
+	var mu sync.Mutex
+	loads := 0
+	d := newDiffBook(book, func() (OrderBookData, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		loads++
+		if loads < 3 {
+			return OrderBookData{}, &client.Error{Class: client.RateLimited, Err: client.ErrRateLimited}
+		}
+		return snapshot(100, "1", "5"), nil
+	}, func() {})
+
+	// one diff, the snapshot is loaded again without waiting for the next
+	d.update(diff(101, 101, "2", "1"))
+	waitFor(t, "snapshot", func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.synced
+	})
+	if got := asks(book); got != "1:5 2:1" {
+		t.Errorf("asks %q, want %q", got, "1:5 2:1")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if loads != 3 {
+		t.Errorf("%d snapshots loaded, want 3", loads)
+	}
+}
+
+// TestStreamDropInvalidatesBook drops the stream connection and checks the
+// book is reset while disconnected and rebuilt from a new snapshot after
+func TestStreamDropInvalidatesBook(t *testing.T) {
+	const stream = "dropusdt@depth"
+	events := func(evs ...DepthEvent) [][]byte {
+		var list [][]byte
+		for _, ev := range evs {
+			data, _ := json.Marshal(map[string]interface{}{"U": ev.FirstUpdateID, "u": ev.LastUpdateID, "a": ev.Asks, "b": [][]interface{}{}})
+			b, _ := json.Marshal(map[string]interface{}{"stream": stream, "data": json.RawMessage(data)})
+			list = append(list, b)
+		}
+		return list
+	}
+	conns := [][][]byte{
+		events(diff(101, 101, "2", "1")),
+		events(diff(201, 201, "3", "1")),
+	}
+	drop := make(chan bool)
+	var mu sync.Mutex
+	n := 0
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.RawQuery, stream) {
+			t.Errorf("dialed %q without %s", r.URL.RawQuery, stream)
+		}
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		mu.Lock()
+		i := n
+		n++
+		mu.Unlock()
+		if i >= len(conns) {
+			return
+		}
+		for _, b := range conns[i] {
+			ws.WriteMessage(websocket.TextMessage, b)
+		}
+		if i == 0 {
+			<-drop
+			ws.UnderlyingConn().Close()
+			return
+		}
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := newStreamMux(ctx, "ws"+strings.TrimPrefix(s.URL, "http"))
+	defer func() {
+		cancel()
+		m.Close()
+	}()
+
+	book, _ := orderbook.GetBook("DROPUSDT")
+	snaps := make(chan OrderBookData, 2)
+	snaps <- snapshot(100, "1", "5")
+	d := newDiffBook(book, func() (OrderBookData, error) {
+		return <-snaps, nil
+	}, func() {})
+	reset := make(chan bool, 1)
+	m.Subscribe(stream, func(b []byte) {
+		var ev DepthEvent
+		if err := json.Unmarshal(b, &ev); err != nil {
+			t.Error(err)
+			return
+		}
+		d.update(ev)
+	}, func() {
+		d.reset()
+		reset <- true
+	})
+
+	waitFor(t, "first book", func() bool { return asks(book) == "1:5 2:1" })
+
+	close(drop)
+	select {
+	case <-reset:
+	case <-time.After(2 * time.Second):
+		t.Fatal("book not invalidated after the drop")
+	}
+	if got := asks(book); got != "" {
+		t.Errorf("asks %q after the drop, want none", got)
+	}
+
+	snaps <- snapshot(200, "4", "4")
+	waitFor(t, "recovered book", func() bool { return asks(book) == "3:1 4:4" })
+}
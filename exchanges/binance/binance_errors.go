@@ -0,0 +1,84 @@
+package binance
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/slicken/arbitrager/client"
+)
+
+// binance error codes, see https://binance-docs.github.io/apidocs/spot/en/#error-codes
+const (
+	codeUnknown          = -1000
+	codeDisconnected     = -1001
+	codeTooManyRequests  = -1003
+	codeTimeout          = -1007
+	codeServerBusy       = -1008
+	codeTooManyOrders    = -1015
+	codeTimestamp        = -1021
+	codeIllegalChars     = -1100
+	codeBadPrecision     = -1111
+	codeFilterFailure    = -1013
+	codeNewOrderRejected = -2010
+	codeCancelRejected   = -2011
+	codeNoSuchOrder      = -2013
+)
+
+// classify returns class of a binance error response
+func classify(status, code int, msg string) client.Class {
+	switch code {
+	case codeTooManyRequests, codeTooManyOrders:
+		return client.RateLimited
+	case codeUnknown, codeDisconnected, codeTimeout, codeServerBusy, codeTimestamp:
+		return client.Retryable
+	case codeFilterFailure, codeBadPrecision, codeIllegalChars:
+		return client.FilterViolation
+	case codeCancelRejected, codeNoSuchOrder:
+		return client.UnknownOrder
+	case codeNewOrderRejected:
+		if strings.Contains(strings.ToLower(msg), "insufficient balance") {
+			return client.InsufficientBalance
+		}
+		return client.Fatal
+	}
+
+	switch {
+	case status == http.StatusTooManyRequests || status == http.StatusTeapot:
+		return client.RateLimited
+	case status >= 500:
+		return client.Retryable
+	}
+	return client.Fatal
+}
+
+// apiError returns a classified error of a response code
+func (e *Binance) apiError(code int, msg string) error {
+	return &client.Error{
+		Exchange: e.Name,
+		Status:   http.StatusOK,
+		Code:     code,
+		Msg:      msg,
+		Class:    classify(http.StatusOK, code, msg),
+	}
+}
+
+// unknownOutcome returns true if err leaves open whether an order was placed:
+// transport errors, timeouts and 5xx responses. rejections like -1021 and
+// -1008 were never placed and are retried as usual
+func unknownOutcome(err error) bool {
+	if err == nil {
+		return false
+	}
+	var e *client.Error
+	if !errors.As(err, &e) {
+		return client.ClassOf(err) == client.Retryable
+	}
+	switch e.Code {
+	case codeTimeout:
+		return true
+	case codeTimestamp, codeServerBusy:
+		return false
+	}
+	return e.Class == client.Retryable && (e.Status == 0 || e.Status >= 500)
+}
@@ -0,0 +1,196 @@
+package binance
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/slicken/arbitrager/client"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		status int
+		code   int
+		msg    string
+		want   client.Class
+	}{
+		{429, codeTooManyRequests, "Too many requests", client.RateLimited},
+		{400, codeTooManyOrders, "Too many new orders", client.RateLimited},
+		{500, codeUnknown, "An unknown error occured", client.Retryable},
+		{503, codeDisconnected, "Internal error", client.Retryable},
+		{408, codeTimeout, "Timeout waiting for response", client.Retryable},
+		{503, codeServerBusy, "Server is currently overloaded", client.Retryable},
+		{400, codeTimestamp, "Timestamp for this request is outside of the recvWindow", client.Retryable},
+		{400, codeFilterFailure, "Filter failure: LOT_SIZE", client.FilterViolation},
+		{400, codeBadPrecision, "Precision is over the maximum", client.FilterViolation},
+		{400, codeIllegalChars, "Illegal characters found", client.FilterViolation},
+		{400, codeCancelRejected, "Unknown order sent", client.UnknownOrder},
+		{400, codeNoSuchOrder, "Order does not exist", client.UnknownOrder},
+		{400, codeNewOrderRejected, "Account has insufficient balance for requested action", client.InsufficientBalance},
+		{400, codeNewOrderRejected, "Market is closed", client.Fatal},
+		// unknown codes fall back to the http status
+		{429, 0, "", client.RateLimited},
+		{418, 0, "", client.RateLimited},
+		{500, 0, "", client.Retryable},
+		{502, -9999, "", client.Retryable},
+		{400, -9999, "", client.Fatal},
+		{401, -2015, "Invalid API-key", client.Fatal},
+		{200, 0, "", client.Fatal},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d %d", tt.status, tt.code), func(t *testing.T) {
+			if got := classify(tt.status, tt.code, tt.msg); got != tt.want {
+				t.Errorf("classify(%d, %d, %q) = %s, want %s", tt.status, tt.code, tt.msg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassOf(t *testing.T) {
+	e := &Binance{}
+	e.Name = "binance"
+	tests := []struct {
+		name      string
+		err       error
+		want      client.Class
+		retryable bool
+	}{
+		{"api error", e.apiError(codeNoSuchOrder, "Order does not exist"), client.UnknownOrder, false},
+		{"wrapped api error", fmt.Errorf("leg 1: %w", e.apiError(codeServerBusy, "")), client.Retryable, true},
+		{"rate limiter", fmt.Errorf("%w: banned", client.ErrRateLimited), client.RateLimited, true},
+		{"network error", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, client.Retryable, true},
+		{"unknown order status", &client.Error{Class: client.Fatal, Err: client.ErrOrderUnknown}, client.Fatal, false},
+		{"plain error", errors.New("boom"), client.Fatal, false},
+		{"nil", nil, client.Fatal, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := client.ClassOf(tt.err); got != tt.want {
+				t.Errorf("ClassOf(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+			if got := client.IsRetryable(tt.err); got != tt.retryable {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.retryable)
+			}
+		})
+	}
+}
+
+func TestUnknownOutcome(t *testing.T) {
+	e := &Binance{}
+	e.Name = "binance"
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"no error", nil, false},
+		{"transport error", &client.Error{Exchange: "binance", Class: client.Retryable, Err: errors.New("read: connection reset")}, true},
+		{"network error", &net.OpError{Op: "read", Err: errors.New("i/o timeout")}, true},
+		{"send status unknown", &client.Error{Status: 503, Code: codeTimeout, Class: client.Retryable}, true},
+		{"send status unknown in body", e.apiError(codeTimeout, "Timeout waiting for response from backend server"), true},
+		{"internal error", &client.Error{Status: 500, Code: codeUnknown, Class: client.Retryable}, true},
+		{"bad gateway", &client.Error{Status: 502, Class: client.Retryable}, true},
+		{"timestamp rejected", &client.Error{Status: 400, Code: codeTimestamp, Class: client.Retryable}, false},
+		{"server busy", &client.Error{Status: 503, Code: codeServerBusy, Class: client.Retryable}, false},
+		{"disconnected rejection", &client.Error{Status: 400, Code: codeDisconnected, Class: client.Retryable}, false},
+		{"rate limited", &client.Error{Status: 429, Code: codeTooManyRequests, Class: client.RateLimited}, false},
+		{"local rate limit", &client.Error{Class: client.RateLimited, Err: client.ErrRateLimited}, false},
+		{"insufficient balance", &client.Error{Status: 400, Code: codeNewOrderRejected, Class: client.InsufficientBalance}, false},
+		{"plain error", errors.New("BTCUSDT info not found"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unknownOutcome(tt.err); got != tt.want {
+				t.Errorf("unknownOutcome(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecoverOrder(t *testing.T) {
+	defer func(d time.Duration) { recoverWindow = d }(recoverWindow)
+	recoverWindow = time.Second
+
+	e := &Binance{}
+	e.Name = "binance"
+	cause := &client.Error{Exchange: "binance", Class: client.Retryable, Err: errors.New("timeout")}
+	notFound := &client.Error{Status: 400, Code: codeNoSuchOrder, Class: client.UnknownOrder}
+	filled := NewOrderResponse{ClientOrderID: "arb-1-0", Status: "FILLED", ExecutedQty: 1, Fills: []Fill{{Price: 2, Qty: 1}}}
+
+	tests := []struct {
+		name    string
+		lookups []NewOrderResponse // a zero Status is not found
+		want    string
+		unknown bool
+		fatal   bool
+	}{
+		{
+			name:    "found at once",
+			lookups: []NewOrderResponse{filled},
+			want:    "FILLED",
+		},
+		{
+			name:    "found after misses",
+			lookups: []NewOrderResponse{{}, {}, filled},
+			want:    "FILLED",
+		},
+		{
+			name:    "partially filled then expired",
+			lookups: []NewOrderResponse{{Status: "EXPIRED", ExecutedQty: 0.5}},
+			want:    "EXPIRED",
+		},
+		{
+			name:    "expired without fills",
+			lookups: []NewOrderResponse{{Status: "EXPIRED"}},
+			fatal:   true,
+		},
+		{
+			name:    "canceled without fills",
+			lookups: []NewOrderResponse{{}, {Status: "CANCELED"}},
+			fatal:   true,
+		},
+		{
+			name:    "never found",
+			unknown: true,
+			fatal:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := 0
+			start := time.Now()
+			resp, err := e.recoverOrder("arb-1-0", cause, func() (NewOrderResponse, error) {
+				i := n
+				n++
+				if i >= len(tt.lookups) || tt.lookups[i].Status == "" {
+					return NewOrderResponse{}, notFound
+				}
+				return tt.lookups[i], nil
+			})
+			if took := time.Since(start); took > recoverWindow+200*time.Millisecond {
+				t.Errorf("took %v, window is %v", took, recoverWindow)
+			}
+			if got := errors.Is(err, client.ErrOrderUnknown); got != tt.unknown {
+				t.Errorf("error %v, want ErrOrderUnknown %v", err, tt.unknown)
+			}
+			if tt.fatal {
+				if err == nil || client.ClassOf(err) != client.Fatal || client.IsRetryable(err) {
+					t.Errorf("error %v, want a fatal error", err)
+				}
+				if tt.unknown && n < 2 {
+					t.Errorf("looked up %d times, want polling", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if resp.Status != tt.want {
+				t.Errorf("status %s, want %s", resp.Status, tt.want)
+			}
+		})
+	}
+}
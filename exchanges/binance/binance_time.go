@@ -0,0 +1,93 @@
+package binance
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/slicken/arbitrager/client"
+	"github.com/slicken/arbitrager/metrics"
+)
+
+const (
+	serverTime = "/api/v3/time"
+
+	defaultRecvWindow = 5000
+	timeSyncInterval  = 10 * time.Minute
+	// log a warning when local clock is off by more than this
+	maxDrift = 500 * time.Millisecond
+)
+
+var (
+	clockOffset = metrics.NewGauge("arbitrager_clock_offset_seconds", "measured offset of exchange server time to local time", "exchange")
+	clockRTT    = metrics.NewGauge("arbitrager_clock_rtt_seconds", "round-trip of the last exchange time sync", "exchange")
+)
+
+// clock holds the measured offset between binance and local time
+type clock struct {
+	mu     sync.Mutex
+	offset time.Duration
+}
+
+// SyncTime measures offset and round-trip to binance server time
+func (e *Binance) SyncTime() error {
+	var resp struct {
+		ServerTime int64 `json:"serverTime"`
+	}
+
+	start := time.Now()
+	if err := e.SendHTTPRequest("GET", apiURL+serverTime, false, &resp); err != nil {
+		return err
+	}
+	rtt := time.Since(start)
+
+	// assume server time was taken halfway
+	server := time.Unix(0, resp.ServerTime*int64(time.Millisecond))
+	offset := server.Sub(start.Add(rtt / 2))
+
+	e.clock.mu.Lock()
+	e.clock.offset = offset
+	e.clock.mu.Unlock()
+	clockOffset.Set(offset.Seconds(), e.Name)
+	clockRTT.Set(rtt.Seconds(), e.Name)
+
+	if offset > maxDrift || offset < -maxDrift {
+		log.Printf("%s clock drift %v (rtt %v)\n", e.Name, offset, rtt)
+	} else if e.Debug {
+		log.Printf("%s clock offset %v (rtt %v)\n", e.Name, offset, rtt)
+	}
+	return nil
+}
+
+// timestamp returns server corrected time in milliseconds
+func (e *Binance) timestamp() int64 {
+	e.clock.mu.Lock()
+	offset := e.clock.offset
+	e.clock.mu.Unlock()
+
+	return time.Now().Add(offset).UnixNano() / int64(time.Millisecond)
+}
+
+// syncTime keeps the clock synced until quit is closed
+func (e *Binance) syncTime(quit <-chan bool) {
+	ticker := time.NewTicker(timeSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			if err := e.SyncTime(); err != nil {
+				log.Printf("%s time sync failed: %v\n", e.Name, err)
+			}
+		}
+	}
+}
+
+// isTimestampError returns true if err is a binance -1021 error
+func isTimestampError(err error) bool {
+	var e *client.Error
+	return errors.As(err, &e) && e.Code == codeTimestamp
+}
@@ -9,6 +9,7 @@ type ExchangeInfo struct {
 	RateLimits []struct {
 		RateLimitType string `json:"rateLimitType"`
 		Interval      string `json:"interval"`
+		IntervalNum   int    `json:"intervalNum"`
 		Limit         int    `json:"limit"`
 	} `json:"rateLimits"`
 	ExchangeFilters interface{} `json:"exchangeFilters"`
@@ -106,12 +107,15 @@ type NewOrderResponse struct {
 	TimeInForce     string  `json:"timeInForce"`
 	Type            string  `json:"type"`
 	Side            string  `json:"side"`
-	Fills           []struct {
-		Price           float64 `json:"price,string"`
-		Qty             float64 `json:"qty,string"`
-		Commission      float64 `json:"commission,string"`
-		CommissionAsset string  `json:"commissionAsset"`
-	} `json:"fills"`
+	Fills           []Fill  `json:"fills"`
+}
+
+// Fill is a trade of an order
+type Fill struct {
+	Price           float64 `json:"price,string"`
+	Qty             float64 `json:"qty,string"`
+	Commission      float64 `json:"commission,string"`
+	CommissionAsset string  `json:"commissionAsset"`
 }
 
 // Result from: GET /api/v3/order
@@ -138,6 +142,15 @@ type SymbolPrice struct {
 	Price  float64 `json:"price,string"`
 }
 
+// Ticker24hr holds 24 hour statistics of a symbol
+type Ticker24hr struct {
+	Symbol      string  `json:"symbol"`
+	LastPrice   float64 `json:"lastPrice,string"`
+	Volume      float64 `json:"volume,string"`
+	QuoteVolume float64 `json:"quoteVolume,string"`
+	Count       int64   `json:"count"`
+}
+
 // Result from: GET /api/v1/allBookTickers
 type BookTicker struct {
 	Symbol      string  `json:"symbol"`
@@ -0,0 +1,344 @@
+package binance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slicken/arbitrager/client"
+	"github.com/slicken/arbitrager/logger"
+)
+
+const (
+	wsStreamURL = "wss://stream.binance.com:9443/stream"
+
+	// binance allows 1024 streams per connection, we keep it lower
+	// so one slow socket does not carry the whole market
+	maxStreamsPerConn = 200
+	// maximum streams in one SUBSCRIBE/UNSUBSCRIBE message
+	maxParamsPerMsg = 100
+	// binance allows 5 incoming messages per second per connection
+	writeInterval = 250 * time.Millisecond
+	// binance disconnects every connection after 24 hours
+	connLifetime = 23 * time.Hour
+)
+
+var streamLog = logger.New("stream")
+
+// streamHandler processes the data of one stream message
+type streamHandler func(data []byte)
+
+// stream holds handlers of a subscribed stream
+type stream struct {
+	fn         streamHandler
+	invalidate func()
+}
+
+// streamMsg is a combined stream message or a subscribe response
+type streamMsg struct {
+	Stream string          `json:"stream"`
+	Data   json.RawMessage `json:"data"`
+	ID     int64           `json:"id"`
+	Error  *struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	} `json:"error"`
+}
+
+// streamReq is a SUBSCRIBE or UNSUBSCRIBE request
+type streamReq struct {
+	Method string   `json:"method"`
+	Params []string `json:"params"`
+	ID     int64    `json:"id"`
+}
+
+// streamConn is one combined stream websocket connection
+type streamConn struct {
+	id      int
+	conn    *client.WsConn
+	streams map[string]bool
+	sub     []string
+	unsub   []string
+}
+
+// load returns number of streams on connection
+func (c *streamConn) load() int {
+	return len(c.streams) + len(c.sub)
+}
+
+// streamMux packs stream subscriptions into a few combined stream connections
+type streamMux struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	url      string
+	ctx      context.Context
+	cancel   context.CancelFunc
+	conns    []*streamConn
+	owner    map[string]*streamConn
+	handlers map[string]stream
+	reqID    int64
+}
+
+func newStreamMux(ctx context.Context, url string) *streamMux {
+	ctx, cancel := context.WithCancel(ctx)
+	return &streamMux{
+		url:      url,
+		ctx:      ctx,
+		cancel:   cancel,
+		owner:    make(map[string]*streamConn),
+		handlers: make(map[string]stream),
+	}
+}
+
+// Subscribe adds stream to the least loaded connection, or opens a new one.
+// invalidate is called when the connection carrying the stream is lost
+func (m *streamMux) Subscribe(name string, fn streamHandler, invalidate func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.handlers[name] = stream{fn: fn, invalidate: invalidate}
+	if _, ok := m.owner[name]; ok {
+		return
+	}
+	// unsubscribed but not sent yet, keep it on its connection
+	for _, c := range m.conns {
+		for i, v := range c.unsub {
+			if v == name {
+				c.unsub = append(c.unsub[:i], c.unsub[i+1:]...)
+				c.streams[name] = true
+				m.owner[name] = c
+				return
+			}
+		}
+	}
+
+	var c *streamConn
+	for _, v := range m.conns {
+		if v.load() >= maxStreamsPerConn {
+			continue
+		}
+		if c == nil || v.load() < c.load() {
+			c = v
+		}
+	}
+	if c == nil {
+		c = m.newConn()
+		c.sub = append(c.sub, name)
+		m.owner[name] = c
+		m.wg.Add(2)
+		go func() {
+			defer m.wg.Done()
+			c.conn.Run(m.ctx)
+		}()
+		go func() {
+			defer m.wg.Done()
+			m.write(c)
+		}()
+		return
+	}
+	c.sub = append(c.sub, name)
+	m.owner[name] = c
+}
+
+// Unsubscribe removes stream from its connection
+func (m *streamMux) Unsubscribe(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.handlers, name)
+	c, ok := m.owner[name]
+	if !ok {
+		return
+	}
+	delete(m.owner, name)
+
+	// not subscribed yet, drop it from the queue
+	for i, v := range c.sub {
+		if v == name {
+			c.sub = append(c.sub[:i], c.sub[i+1:]...)
+			return
+		}
+	}
+	delete(c.streams, name)
+	c.unsub = append(c.unsub, name)
+}
+
+// Close closes all connections and waits for them to finish
+func (m *streamMux) Close() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// Streams returns number of streams and connections
+func (m *streamMux) Streams() (streams int, conns int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.owner), len(m.conns)
+}
+
+// newConn returns a new streamConn. must be called with m.mu locked
+func (m *streamMux) newConn() *streamConn {
+	c := &streamConn{id: len(m.conns), streams: make(map[string]bool)}
+	m.conns = append(m.conns, c)
+
+	c.conn = client.NewWsConn(fmt.Sprintf("binance stream %d", c.id), func() (string, error) {
+		return m.url + "?streams=" + strings.Join(m.dialStreams(c), "/"), nil
+	})
+	c.conn.Lifetime = connLifetime
+	c.conn.OnMessage = func(b []byte) {
+		m.read(c, b)
+	}
+	c.conn.OnConnect = func() {
+		m.mu.Lock()
+		n := len(c.streams)
+		m.mu.Unlock()
+		streamLog.Info("connected", "conn", c.id, "streams", n)
+	}
+	c.conn.OnDisconnect = func(err error) {
+		m.invalidate(c)
+	}
+	return c
+}
+
+// dialStreams moves queued subscriptions of c into its streams and returns them all
+func (m *streamMux) dialStreams(c *streamConn) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range c.sub {
+		c.streams[s] = true
+	}
+	c.sub = nil
+	c.unsub = nil
+	list := make([]string, 0, len(c.streams))
+	for s := range c.streams {
+		list = append(list, s)
+	}
+	return list
+}
+
+// invalidate resets every stream of c while it is disconnected
+func (m *streamMux) invalidate(c *streamConn) {
+	m.mu.Lock()
+	var fns []func()
+	for s := range c.streams {
+		if h, ok := m.handlers[s]; ok && h.invalidate != nil {
+			fns = append(fns, h.invalidate)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// Conns returns the connection managers of all stream connections
+func (m *streamMux) Conns() []*client.WsConn {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]*client.WsConn, 0, len(m.conns))
+	for _, c := range m.conns {
+		list = append(list, c.conn)
+	}
+	return list
+}
+
+// read dispatches a stream message to its handler
+func (m *streamMux) read(c *streamConn, b []byte) {
+	var msg streamMsg
+	if err := json.Unmarshal(b, &msg); err != nil {
+		streamLog.Warn("bad message", "conn", c.id, "err", err)
+		return
+	}
+	if msg.Error != nil {
+		streamLog.Warn("request failed", "conn", c.id, "id", msg.ID, "code", msg.Error.Code, "msg", msg.Error.Msg)
+		return
+	}
+	if msg.Stream == "" {
+		return
+	}
+
+	m.mu.Lock()
+	h := m.handlers[msg.Stream]
+	m.mu.Unlock()
+	if h.fn != nil {
+		h.fn(msg.Data)
+	}
+}
+
+// write sends queued SUBSCRIBE and UNSUBSCRIBE requests, one per interval
+func (m *streamMux) write(c *streamConn) {
+	ticker := time.NewTicker(writeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if ok, _ := c.conn.Connected(); !ok {
+			continue
+		}
+
+		m.mu.Lock()
+		var req streamReq
+		switch {
+		case len(c.sub) > 0:
+			n := len(c.sub)
+			if n > maxParamsPerMsg {
+				n = maxParamsPerMsg
+			}
+			req.Method = "SUBSCRIBE"
+			req.Params = append([]string{}, c.sub[:n]...)
+			c.sub = c.sub[n:]
+			for _, s := range req.Params {
+				c.streams[s] = true
+			}
+		case len(c.unsub) > 0:
+			n := len(c.unsub)
+			if n > maxParamsPerMsg {
+				n = maxParamsPerMsg
+			}
+			req.Method = "UNSUBSCRIBE"
+			req.Params = append([]string{}, c.unsub[:n]...)
+			c.unsub = c.unsub[n:]
+		}
+		if req.Method == "" {
+			m.mu.Unlock()
+			continue
+		}
+		m.reqID++
+		req.ID = m.reqID
+		m.mu.Unlock()
+
+		if err := c.conn.WriteJSON(req); err != nil {
+			streamLog.Warn("write failed", "conn", c.id, "method", req.Method, "err", err)
+			// queue again, they are sent on next connect anyway.
+			// skip streams (un)subscribed again meanwhile
+			m.mu.Lock()
+			var list []string
+			for _, s := range req.Params {
+				owner, ok := m.owner[s]
+				if req.Method == "SUBSCRIBE" && owner == c || req.Method == "UNSUBSCRIBE" && !ok {
+					list = append(list, s)
+				}
+			}
+			if req.Method == "SUBSCRIBE" {
+				for _, s := range list {
+					delete(c.streams, s)
+				}
+				c.sub = append(list, c.sub...)
+			} else {
+				c.unsub = append(list, c.unsub...)
+			}
+			m.mu.Unlock()
+		}
+	}
+}
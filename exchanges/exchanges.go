@@ -1,12 +1,14 @@
 package exchanges
 
 import (
+	"context"
 	"errors"
 
 	"github.com/slicken/arbitrager/client"
 	"github.com/slicken/arbitrager/config"
 	"github.com/slicken/arbitrager/currencie"
 	"github.com/slicken/arbitrager/orderbook"
+	"github.com/slicken/arbitrager/orders"
 	"github.com/slicken/history"
 )
 
@@ -34,23 +36,31 @@ type I interface {
 	Pair(pair string) (currencie.Pair, error)
 	AllPairs() map[string]currencie.Pair
 	UpdatePairs() error
+	Usage() []client.LimitUsage
 	// ACCOUNT
 	UpdateBalance() error
 	// BOOK
 	GetTicker(pair string) (float64, error)
 	GetAllTickers() (map[string]float64, error)
+	GetBookTicker(pair string) (bid, ask float64, err error)
+	GetVolumes() (map[string]float64, error)
 	GetKlines(pair, tf string, limit int) (history.Bars, error)
 	GetOrderbook(pair string, limit int64) (*orderbook.Book, error)
 	// ORDER
-	SendLimit(pair, side string, amount, price float64) error
-	SendMarket(pair, side string, amount, quoteAmount float64) (float64, error)
+	SendLimit(pair, side string, amount, price float64, clientID string) error
+	SendMarket(pair, side string, amount, quoteAmount float64, clientID string) (*orders.Trade, error)
+	TestMarket(pair, side string, amount, quoteAmount float64) error
 	SendCancel(pair string, id int64) error
+	GetOpenOrders() ([]*orders.Order, error)
 	OrderStatus(id int64) (string, error)
 	OrderFills(id int64) (float64, error)
 	LastTrade(symbol string, len int64) (price float64, amount float64, qqty float64, fee float64, err error)
 	// WS
-	StreamBookDiff(pair string, done <-chan bool, notify chan<- string) error  //ws:
-	StreamBookDepth(pair string, done <-chan bool, notify chan<- string) error //ws:
+	StreamBookDiff(ctx context.Context, pair string, notify *orderbook.Notifier) error  //ws:
+	StreamBookDepth(ctx context.Context, pair string, notify *orderbook.Notifier) error //ws:
+	Unsubscribe(pair string) error                                                      //ws:
+	Conns() []*client.WsConn                                                            //ws:
+	Close() error                                                                       //ws:
 }
 
 // GetName returns exchangd name
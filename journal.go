@@ -0,0 +1,164 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/slicken/arbitrager/journal"
+	"github.com/slicken/arbitrager/orderbook"
+	"github.com/slicken/arbitrager/orders"
+)
+
+const (
+	journalFile  = "journal.jsonl"
+	journalDepth = 5
+)
+
+// usdValue returns value of amount asset in USD, 0 if unknown
+func usdValue(asset string, amount float64) float64 {
+	switch asset {
+	case "USDT", "BUSD", "USDC", "TUSD", "PAX":
+		return amount
+	}
+	if price, ok := tickers[asset+"USDT"]; ok {
+		return amount * price
+	}
+	if price, ok := tickers["USDT"+asset]; ok && price != 0 {
+		return amount / price
+	}
+	return 0
+}
+
+// entry returns a journal entry with route fields of o
+func (o *OrderSet) entry(typ string) journal.Entry {
+	e := journal.Entry{
+		Type:    typ,
+		Route:   o.id,
+		Asset:   o.asset,
+		Initial: o.initial,
+	}
+	for i, p := range o.pair {
+		e.Pairs = append(e.Pairs, p.Name)
+		e.Sides = append(e.Sides, Side[o.route[i]])
+	}
+	return e
+}
+
+// journalOpportunity records o with a snapshot of its books
+func journalOpportunity(o *OrderSet) {
+	e := o.entry(journal.Opportunity)
+	e.Profit = o.profit
+	e.Perc = o.perc
+	e.Prices = o.price[:]
+	for _, p := range o.pair {
+		book, _ := orderbook.GetBook(p.Name)
+		e.Books = append(e.Books, book.Snapshot(journalDepth))
+	}
+	journal.Add(e)
+}
+
+// journalDecision records if o is executed or skipped and why.
+// reason is a fixed code summaries count by, details may vary
+func journalDecision(o *OrderSet, decision, reason, details string) {
+	e := o.entry(journal.Decision)
+	e.Decision = decision
+	e.Reason = reason
+	e.Details = details
+	journal.Add(e)
+}
+
+// journalOrder records one order attempt of leg
+func journalOrder(o *OrderSet, leg int, req journal.OrderRequest, trade *orders.Trade, latency time.Duration, err error) {
+	e := o.entry(journal.Order)
+	e.Leg = leg
+	e.Request = &req
+	e.Trade = trade
+	e.Latency = latency
+	if err != nil {
+		e.Error = err.Error()
+	}
+	journal.Add(e)
+}
+
+// journalResult records the realized result of o
+func journalResult(o *OrderSet, final float64, err error) {
+	e := o.entry(journal.Result)
+	if err != nil {
+		e.Error = err.Error()
+		journal.Add(e)
+		return
+	}
+	e.PnL = final - o.initial
+	e.PnLPerc = (final/o.initial)*100 - 100
+	e.PnLUSD = usdValue(o.asset, e.PnL)
+	journal.Add(e)
+}
+
+// runJournal prints a summary of the journal
+func runJournal(args []string) {
+	fs := flag.NewFlagSet("journal", flag.ExitOnError)
+	file := fs.String("f", journalFile, "journal file")
+	from := fs.String("from", "", "from date (YYYYMMDD)")
+	to := fs.String("to", "", "to date (YYYYMMDD), exclusive")
+	fs.Parse(args)
+
+	var t0, t1 time.Time
+	var err error
+	if *from != "" {
+		if t0, err = time.ParseInLocation("20060102", *from, time.Local); err != nil {
+			fmt.Println("invalid -from:", err)
+			os.Exit(1)
+		}
+	}
+	if *to != "" {
+		if t1, err = time.ParseInLocation("20060102", *to, time.Local); err != nil {
+			fmt.Println("invalid -to:", err)
+			os.Exit(1)
+		}
+	}
+
+	list, err := journal.Read(*file, t0, t1)
+	if err != nil {
+		fmt.Println("could not read journal:", err)
+		os.Exit(1)
+	}
+	s := journal.Summarize(list)
+
+	fmt.Printf("opportunities  %d\n", s.Opportunities)
+	fmt.Printf("executed       %d (%d wins, %d losses)\n", s.Executed, s.Wins, s.Losses)
+	fmt.Printf("failed         %d\n", s.Failed)
+	var reasons []string
+	for k := range s.Skipped {
+		reasons = append(reasons, k)
+	}
+	sort.Strings(reasons)
+	for _, k := range reasons {
+		fmt.Printf("skipped        %-6d %s\n", s.Skipped[k], k)
+	}
+	for _, k := range sortedKeys(s.PnL) {
+		fmt.Printf("pnl            %-12f %s\n", s.PnL[k], k)
+	}
+	for _, k := range sortedKeys(s.Commission) {
+		fmt.Printf("commission     %-12f %s\n", s.Commission[k], k)
+	}
+	fmt.Printf("pnl USD        %-12f\n", s.PnLUSD)
+	if len(s.Routes) > 0 {
+		fmt.Println("\nroutes")
+	}
+	for _, r := range s.Routes {
+		fmt.Printf("  %-5d %12f USD   %s\n", r.Count, r.PnLUSD, r.Name)
+	}
+}
+
+// sortedKeys returns sorted keys of m
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
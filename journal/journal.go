@@ -0,0 +1,249 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/slicken/arbitrager/orderbook"
+	"github.com/slicken/arbitrager/orders"
+)
+
+// Entry types
+const (
+	Opportunity = "opportunity"
+	Decision    = "decision"
+	Order       = "order"
+	Result      = "result"
+)
+
+// Decisions
+const (
+	Execute = "execute"
+	Skip    = "skip"
+)
+
+// Entry is one line in the journal
+type Entry struct {
+	Time  time.Time `json:"time"`
+	Type  string    `json:"type"`
+	Route string    `json:"route,omitempty"`
+
+	// Opportunity
+	Asset   string               `json:"asset,omitempty"`
+	Pairs   []string             `json:"pairs,omitempty"`
+	Sides   []string             `json:"sides,omitempty"`
+	Initial float64              `json:"initial,omitempty"`
+	Profit  float64              `json:"profit,omitempty"`
+	Perc    float64              `json:"perc,omitempty"`
+	Prices  []float64            `json:"prices,omitempty"`
+	Books   []orderbook.Snapshot `json:"books,omitempty"`
+
+	// Decision, Reason is a fixed code and Details tells more
+	Decision string `json:"decision,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	Details  string `json:"details,omitempty"`
+
+	// Order, Leg counts from 0 so it is always written
+	Leg     int           `json:"leg"`
+	Request *OrderRequest `json:"request,omitempty"`
+	Trade   *orders.Trade `json:"trade,omitempty"`
+	Latency time.Duration `json:"latency,omitempty"`
+	Error   string        `json:"error,omitempty"`
+
+	// Result
+	PnL     float64 `json:"pnl,omitempty"`
+	PnLPerc float64 `json:"pnl_perc,omitempty"`
+	PnLUSD  float64 `json:"pnl_usd,omitempty"`
+}
+
+// OrderRequest is what we asked the exchange for
+type OrderRequest struct {
+	Pair     string  `json:"pair"`
+	Side     string  `json:"side"`
+	Amount   float64 `json:"amount,omitempty"`
+	Quote    float64 `json:"quote,omitempty"`
+	ClientID string  `json:"client_id,omitempty"`
+}
+
+var (
+	mu   sync.Mutex
+	file *os.File
+
+	// OnAdd is called with every entry, eg. to alert it
+	OnAdd func(e Entry)
+)
+
+// Open opens filename for appending, creating it if needed
+func Open(filename string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	file = f
+	return nil
+}
+
+// Close flushes and closes the journal
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if file == nil {
+		return nil
+	}
+	file.Sync()
+	err := file.Close()
+	file = nil
+	return err
+}
+
+// Add writes e to the journal. it does nothing if the journal is not open
+func Add(e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if OnAdd != nil {
+		OnAdd(e)
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Println("journal:", err.Error())
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if file == nil {
+		return
+	}
+	if _, err := file.Write(append(b, '\n')); err != nil {
+		log.Println("journal:", err.Error())
+	}
+}
+
+// Read returns all entries of filename between from and to. zero times are ignored
+func Read(filename string, from, to time.Time) ([]Entry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var list []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if !from.IsZero() && e.Time.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !e.Time.Before(to) {
+			continue
+		}
+		list = append(list, e)
+	}
+	return list, scanner.Err()
+}
+
+// Summary of journal entries
+type Summary struct {
+	Opportunities int
+	Executed      int
+	Skipped       map[string]int
+	Failed        int
+	Wins          int
+	Losses        int
+	PnL           map[string]float64
+	PnLUSD        float64
+	Commission    map[string]float64
+	Routes        []RouteSummary
+}
+
+// RouteSummary holds results of one route shape and pairs
+type RouteSummary struct {
+	Name   string
+	Count  int
+	PnLUSD float64
+}
+
+// Summarize sums up entries
+func Summarize(list []Entry) Summary {
+	s := Summary{
+		Skipped:    make(map[string]int),
+		PnL:        make(map[string]float64),
+		Commission: make(map[string]float64),
+	}
+	routes := make(map[string]*RouteSummary)
+
+	for _, e := range list {
+		switch e.Type {
+		case Opportunity:
+			s.Opportunities++
+		case Decision:
+			if e.Decision == Skip {
+				s.Skipped[e.Reason]++
+			}
+		case Order:
+			if e.Trade != nil {
+				for _, f := range e.Trade.Fills {
+					s.Commission[f.CommissionAsset] += f.Commission
+				}
+			}
+		case Result:
+			if e.Error != "" {
+				s.Failed++
+				continue
+			}
+			s.Executed++
+			if e.PnL > 0 {
+				s.Wins++
+			} else {
+				s.Losses++
+			}
+			s.PnL[e.Asset] += e.PnL
+			s.PnLUSD += e.PnLUSD
+
+			name := routeName(e)
+			r, ok := routes[name]
+			if !ok {
+				r = &RouteSummary{Name: name}
+				routes[name] = r
+			}
+			r.Count++
+			r.PnLUSD += e.PnLUSD
+		}
+	}
+
+	for _, r := range routes {
+		s.Routes = append(s.Routes, *r)
+	}
+	sort.Slice(s.Routes, func(i, j int) bool {
+		return s.Routes[i].PnLUSD > s.Routes[j].PnLUSD
+	})
+	return s
+}
+
+// routeName returns a readable name of the route in e
+func routeName(e Entry) string {
+	name := e.Asset
+	for i, p := range e.Pairs {
+		side := ""
+		if i < len(e.Sides) {
+			side = e.Sides[i]
+		}
+		name += " " + side + " " + p
+	}
+	return name
+}
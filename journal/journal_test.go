@@ -0,0 +1,111 @@
+package journal
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/slicken/arbitrager/orders"
+)
+
+// result returns a result entry of a route from USDT over BTC and ETH
+func result(pnl, usd float64, err string) Entry {
+	return Entry{Type: Result, Asset: "USDT", Pairs: []string{"BTCUSDT", "ETHBTC", "ETHUSDT"},
+		Sides: []string{"BUY", "BUY", "SELL"}, PnL: pnl, PnLUSD: usd, Error: err}
+}
+
+func TestSummarize(t *testing.T) {
+	const route = "USDT BUY BTCUSDT BUY ETHBTC SELL ETHUSDT"
+	other := result(-1, -1, "")
+	other.Sides = []string{"SELL", "SELL", "BUY"}
+	const otherRoute = "USDT SELL BTCUSDT SELL ETHBTC BUY ETHUSDT"
+
+	tests := []struct {
+		name string
+		list []Entry
+		want Summary
+	}{
+		{
+			name: "empty",
+			want: Summary{Skipped: map[string]int{}, PnL: map[string]float64{}, Commission: map[string]float64{}},
+		},
+		{
+			name: "opportunities and skips",
+			list: []Entry{
+				{Type: Opportunity}, {Type: Opportunity}, {Type: Opportunity},
+				{Type: Decision, Decision: Skip, Reason: "cooldown"},
+				{Type: Decision, Decision: Skip, Reason: "cooldown"},
+				{Type: Decision, Decision: Skip, Reason: "risk"},
+				{Type: Decision, Decision: Execute},
+			},
+			want: Summary{Opportunities: 3, Skipped: map[string]int{"cooldown": 2, "risk": 1}, PnL: map[string]float64{}, Commission: map[string]float64{}},
+		},
+		{
+			name: "commissions",
+			list: []Entry{
+				{Type: Order, Trade: &orders.Trade{Fills: []orders.Fill{{Commission: 0.25, CommissionAsset: "BNB"}, {Commission: 0.5, CommissionAsset: "BNB"}}}},
+				{Type: Order, Trade: &orders.Trade{Fills: []orders.Fill{{Commission: 1, CommissionAsset: "USDT"}}}},
+				{Type: Order, Error: "rejected"},
+			},
+			want: Summary{Skipped: map[string]int{}, PnL: map[string]float64{}, Commission: map[string]float64{"BNB": 0.75, "USDT": 1}},
+		},
+		{
+			name: "results by route",
+			list: []Entry{result(2, 2, ""), result(1, 1, ""), result(0, 0, ""), other, result(0, 0, "leg 1: timeout")},
+			want: Summary{
+				Executed: 4, Failed: 1, Wins: 2, Losses: 2,
+				Skipped:    map[string]int{},
+				PnL:        map[string]float64{"USDT": 2},
+				PnLUSD:     2,
+				Commission: map[string]float64{},
+				Routes:     []RouteSummary{{Name: route, Count: 3, PnLUSD: 3}, {Name: otherRoute, Count: 1, PnLUSD: -1}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Summarize(tt.list); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Summarize = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "journal.jsonl")
+	if err := Open(file); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		Add(Entry{Time: start.Add(time.Duration(i) * time.Hour), Type: Opportunity})
+	}
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+	// entries added after close are dropped
+	Add(Entry{Type: Opportunity})
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     int
+	}{
+		{"all", time.Time{}, time.Time{}, 4},
+		{"from", start.Add(time.Hour), time.Time{}, 3},
+		{"to excluded", time.Time{}, start.Add(2 * time.Hour), 2},
+		{"between", start.Add(time.Hour), start.Add(3 * time.Hour), 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := Read(file, tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != tt.want {
+				t.Errorf("%d entries, want %d", len(list), tt.want)
+			}
+		})
+	}
+}
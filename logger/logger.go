@@ -0,0 +1,240 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level of a message
+type Level int
+
+// levels
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < Debug || l > Error {
+		return "level" + strconv.Itoa(int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level of name
+func ParseLevel(name string) (Level, error) {
+	for i, n := range levelNames {
+		if strings.EqualFold(n, name) {
+			return Level(i), nil
+		}
+	}
+	return Info, fmt.Errorf("unknown log level %q, use debug, info, warn or error", name)
+}
+
+var (
+	mu     sync.RWMutex
+	out    io.Writer = os.Stderr
+	asJSON bool
+	level  = Info
+	levels = make(map[string]Level)
+)
+
+// Configure sets the format (text or json), the default level and levels by component
+func Configure(format, defaultLevel string, components map[string]string) error {
+	var err error
+	l := Info
+	if defaultLevel != "" {
+		if l, err = ParseLevel(defaultLevel); err != nil {
+			return err
+		}
+	}
+	m := make(map[string]Level)
+	for c, name := range components {
+		if m[c], err = ParseLevel(name); err != nil {
+			return fmt.Errorf("component %s: %v", c, err)
+		}
+	}
+	switch format {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("unknown log format %q, use text or json", format)
+	}
+
+	mu.Lock()
+	asJSON = format == "json"
+	level = l
+	levels = m
+	mu.Unlock()
+
+	if asJSON {
+		// the std adapter adds the time
+		log.SetFlags(0)
+	} else {
+		log.SetFlags(log.LstdFlags)
+	}
+	log.SetOutput(std{})
+	return nil
+}
+
+// SetLevel sets the level of component
+func SetLevel(component string, l Level) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	levels[component] = l
+}
+
+// SetOutput sets where messages and the standard log are written
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	out = w
+	mu.Unlock()
+
+	log.SetOutput(std{})
+}
+
+// write writes one line to out
+func write(b []byte) (int, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return out.Write(b)
+}
+
+// std passes lines of the standard log to out, as info messages in json
+type std struct{}
+
+func (std) Write(b []byte) (int, error) {
+	mu.RLock()
+	j := asJSON
+	mu.RUnlock()
+	if !j {
+		return write(b)
+	}
+	msg := strings.TrimRight(string(b), "\n")
+	if _, err := write(record(time.Now(), Info, "app", msg, nil, true)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Logger logs messages of a component with key value fields
+type Logger struct {
+	component string
+}
+
+// New returns the logger of component
+func New(component string) *Logger {
+	return &Logger{component}
+}
+
+// Enabled returns true if messages of level are written
+func (l *Logger) Enabled(lv Level) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	min, ok := levels[l.component]
+	if !ok {
+		min = level
+	}
+	return lv >= min
+}
+
+// Debug logs msg with fields in key value pairs
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.log(Debug, msg, kv) }
+
+// Info logs msg with fields in key value pairs
+func (l *Logger) Info(msg string, kv ...interface{}) { l.log(Info, msg, kv) }
+
+// Warn logs msg with fields in key value pairs
+func (l *Logger) Warn(msg string, kv ...interface{}) { l.log(Warn, msg, kv) }
+
+// Error logs msg with fields in key value pairs
+func (l *Logger) Error(msg string, kv ...interface{}) { l.log(Error, msg, kv) }
+
+func (l *Logger) log(lv Level, msg string, kv []interface{}) {
+	if !l.Enabled(lv) {
+		return
+	}
+	mu.RLock()
+	j := asJSON
+	mu.RUnlock()
+	write(record(time.Now(), lv, l.component, msg, kv, j))
+}
+
+// record formats one message as a line of text or json
+func record(t time.Time, lv Level, component, msg string, kv []interface{}, asJSON bool) []byte {
+	var b bytes.Buffer
+	if asJSON {
+		b.WriteString(`{"time":`)
+		writeJSON(&b, t.Format(time.RFC3339Nano))
+		b.WriteString(`,"level":`)
+		writeJSON(&b, lv.String())
+		b.WriteString(`,"component":`)
+		writeJSON(&b, component)
+		b.WriteString(`,"msg":`)
+		writeJSON(&b, msg)
+		for i := 0; i < len(kv); i += 2 {
+			b.WriteByte(',')
+			writeJSON(&b, key(kv, i))
+			b.WriteByte(':')
+			writeJSON(&b, value(kv, i))
+		}
+		b.WriteString("}\n")
+		return b.Bytes()
+	}
+
+	fmt.Fprintf(&b, "%s %-5s %s: %s", t.Format("2006/01/02 15:04:05"), strings.ToUpper(lv.String()), component, msg)
+	for i := 0; i < len(kv); i += 2 {
+		s := fmt.Sprint(value(kv, i))
+		if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+			s = strconv.Quote(s)
+		}
+		fmt.Fprintf(&b, " %s=%s", key(kv, i), s)
+	}
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+func key(kv []interface{}, i int) string {
+	if s, ok := kv[i].(string); ok {
+		return s
+	}
+	return fmt.Sprint(kv[i])
+}
+
+// value returns the value of key i, errors as their message
+func value(kv []interface{}, i int) interface{} {
+	if i+1 >= len(kv) {
+		return "MISSING"
+	}
+	if err, ok := kv[i+1].(error); ok {
+		return err.Error()
+	}
+	return kv[i+1]
+}
+
+func writeJSON(b *bytes.Buffer, v interface{}) {
+	j, err := json.Marshal(v)
+	if err != nil {
+		j, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(j)
+}
+
+// Millis returns d in milliseconds, for latency fields
+func Millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
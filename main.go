@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -12,12 +14,27 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/slicken/arbitrager/alert"
 	"github.com/slicken/arbitrager/balance"
+	"github.com/slicken/arbitrager/client"
 	"github.com/slicken/arbitrager/config"
+	"github.com/slicken/arbitrager/confirm"
+	"github.com/slicken/arbitrager/episodes"
 	"github.com/slicken/arbitrager/exchanges"
+	"github.com/slicken/arbitrager/journal"
+	"github.com/slicken/arbitrager/logger"
+	"github.com/slicken/arbitrager/orderbook"
+	"github.com/slicken/arbitrager/orders"
+	"github.com/slicken/arbitrager/pnl"
+	"github.com/slicken/arbitrager/risk"
+	"github.com/slicken/arbitrager/slippage"
 	"github.com/slicken/arbitrager/utils"
 )
 
+// maxRateLimitWait is the longest a route waits for a rate limit between
+// order tries, a longer ban halts it
+const maxRateLimitWait = 30 * time.Second
+
 var (
 	// app arguments
 	assets   []string
@@ -31,173 +48,90 @@ var (
 	obdiff   bool    = false
 	cpu      int     = 0
 	limit    int     = 1024
+	priority string  = "volume"
 	verbose  bool    = false
 	debug    bool    = false
+	dryrun   bool    = false
+	scanOnly bool    = false
+	screen   bool    = false
 	// app variables - dont change
 	E          exchanges.I
 	tickers    map[string]float64
-	shutdown   = make(chan bool)
 	_, appName = filepath.Split(os.Args[0])
 	lastTrade  = time.Now()
+	started    = time.Now()
+	// session counters
+	found    int
+	executed int
+	failed   int
+	// loggers by component
+	scanLog  = logger.New("scanner")
+	tradeLog = logger.New("trade")
 )
 
-func appInfo(code int) {
-	fmt.Println(`Usage: ./` + appName + ` [-a <assets>|--all] [-e <assets>] [-t <percent>] [-n <uint>] [-m <USD>]
-             [--100] [--CPU <cores>] [--verbose] [-l <uint>] [--sec <uint>]
-
-Arguments       Default   Example   Info
-  -a, --asset             USDT,BTC  enter assets to arbitrage. separateor ',' if more than one
-      --all                         arbitrage all assets with a balance
-  -e, --except            USDC      except thease assets
-  -t, --target    2.0     1.7       minimum target in percentage to trade
-  -s, --size      100     500       tradesize mearesured in USD. (0=blanace)
-  -n, --decrease          2         also look for arbitrages with a decrease balance N times
-  -l, --limit     1024              limit maximum connections to orderbooks
-      --diff      false             streams orderbook diffs (1sec) instead of snapshots (100ms)
-      --download  max     2         downloads orderbook, for '--diff' mode only
-      --CPU                         limit usage of cpu cores
-      --verbose
-  -h  --help`)
-	os.Exit(code)
-}
-
-// Split makes slice of string
-func Split(s string) []string {
-	var slice []string
-	for _, v := range strings.Split(s, ",") {
-		slice = append(slice, v)
-	}
-	return slice
-}
-
 func main() {
 
 	// APP ARGUMENTS
+	cfgErr := config.ReadConfig()
 	if 2 > len(os.Args) {
 		appInfo(1)
-	} else {
-		for i, arg := range os.Args[1:] {
-			switch arg {
-			case "-a", "--asset":
-				if i+3 > len(os.Args) {
-					appInfo(1)
-				}
-				assets = Split(os.Args[i+2])
-
-			case "--all":
-				all = true
-
-			case "-e", "--except":
-				if i+3 > len(os.Args) {
-					appInfo(1)
-				}
-				except = Split(os.Args[i+2])
-
-			case "-t", "--target":
-				if i+3 > len(os.Args) {
-					appInfo(1)
-				}
-				v, err := strconv.ParseFloat(os.Args[i+2], 64)
-				if err != nil {
-					appInfo(1)
-				}
-				target = v
-
-			case "-n", "--decrease":
-				if i+3 > len(os.Args) {
-					appInfo(1)
-				}
-				v, err := strconv.Atoi(os.Args[i+2])
-				if err != nil {
-					appInfo(1)
-				}
-				steps = v
-				log.Printf("decrease balance %d times\n", steps)
-
-			case "-s", "--size":
-				if i+3 > len(os.Args) {
-					appInfo(1)
-				}
-				v, err := strconv.ParseFloat(os.Args[i+2], 64)
-				if err != nil {
-					appInfo(1)
-				}
-				size = v
-				log.Println("tradesize (in USD)", size)
-
-			case "-m", "--minimum":
-				if i+3 > len(os.Args) {
-					appInfo(1)
-				}
-				v, err := strconv.ParseFloat(os.Args[i+2], 64)
-				if err != nil {
-					appInfo(1)
-				}
-				minimum = v
-				log.Println("min tradesize (in USD)", minimum)
-
-			case "--download":
-				download = true
-				log.Println("dowloading orderbooks")
-
-			case "-l", "--limit":
-				if i+3 > len(os.Args) {
-					appInfo(1)
-				}
-				v, err := strconv.Atoi(os.Args[i+2])
-				if err != nil {
-					appInfo(1)
-				}
-				limit = v
-				log.Println("limit orderbooks to", limit)
-
-			case "--diff":
-				obdiff = true
-				log.Println("orderbook diff enabled (1sec update)")
-
-			case "--CPU":
-				if i+3 > len(os.Args) {
-					appInfo(1)
-				}
-				v, err := strconv.Atoi(os.Args[i+2])
-				if err != nil {
-					appInfo(1)
-				}
-				cpu = v
-				log.Println("cpu cores limited to", cpu)
-
-			case "-h", "--h", "-help", "--help", "help":
-				appInfo(0)
-
-			case "--verbose":
-				verbose = true
-				log.Println("verbose enabled")
-
-			case "--debug":
-				debug = true
-				log.Println("debug enabled")
-
-			default:
-			}
+	}
+	name, args := os.Args[1], os.Args[2:]
+	if strings.HasPrefix(name, "-") && name != "-h" && name != "--help" {
+		// flags without command
+		name, args = "run", os.Args[1:]
+	}
+	switch name {
+	case "run", "scan":
+		parseRunFlags(name, args)
+		scanOnly = name == "scan"
+	case "-h", "--help", "help":
+		appInfo(0)
+	default:
+		c, ok := findCommand(name)
+		if !ok {
+			fmt.Printf("unknown command %q\n\n", name)
+			appInfo(1)
 		}
+		c.run(args)
+		return
 	}
-	if !all && len(assets) == 0 {
-		appInfo(1)
+	log.Printf("target is %.2f%%, size %.2f USD, minimum %.2f USD\n", target, size, minimum)
+	if steps > 1 {
+		log.Printf("decrease size %d times\n", steps)
+	}
+	if obdiff {
+		log.Println("orderbook diff enabled (1sec update)")
+	}
+	if dryrun {
+		log.Println("dry run enabled, no orders will be placed")
+	}
+	if scanOnly {
+		log.Println("scan only, no orders will be placed")
 	}
-	log.Printf("target is %.2f%%\n", target)
 
 	// HANDLE INTERRUPT SIGNAL
-	HandleInterrupt()
+	ctx, cancel := context.WithCancel(context.Background())
+	HandleInterrupt(cancel)
 
 	// LIMIT CPU CORES
 	if cpu != 0 {
 		runtime.GOMAXPROCS(cpu)
 	}
 	// LOAD CONFIG FILE
-	if err := config.ReadConfig(); err != nil {
-		log.Fatalln("could not load config file:", err.Error())
+	if cfgErr != nil {
+		log.Fatalln("could not load config file:", cfgErr.Error())
+	}
+	if err := configureLog(); err != nil {
+		log.Fatalln("could not configure logging:", err.Error())
 	}
 	log.Println("reading config...")
+	risk.SetLimits(config.Cfg.Risk)
+	confirm.SetPolicy(config.Cfg.Confirm)
+	if p := config.Cfg.Confirm; p.Updates > 1 || p.Millis > 0 || p.BookTicker {
+		log.Printf("confirm opportunities: %d updates, %dms, book ticker %v\n", p.Updates, p.Millis, p.BookTicker)
+	}
+	HandleKillSignals()
 
 	// LOAD EXCHANGE
 	if err := LoadExchange("binance"); err != nil {
@@ -206,7 +140,28 @@ func main() {
 	log.Println("connected to", E.GetName())
 
 	// LOG TO FILE
-	utils.LogToFile(appName)
+	c := config.Cfg.Log
+	utils.LogToFile(appName, utils.LogRotation{
+		Dir:      c.Dir,
+		MaxSize:  int64(c.MaxSizeMB) << 20,
+		MaxFiles: c.MaxFiles,
+		MaxAge:   time.Duration(c.MaxAgeDays) * 24 * time.Hour,
+	})
+	if err := journal.Open(dataFile(journalFile)); err != nil {
+		log.Println("could not open journal:", err.Error())
+	}
+	if t := config.Cfg.Episodes.Threshold; t > 0 {
+		if err := episodes.Open(dataFile(episodesFile), t); err != nil {
+			log.Println("could not open episodes:", err.Error())
+		}
+	}
+	if err := pnl.Load(dataFile(pnlFile), "USDT"); err != nil {
+		log.Fatalln("could not load pnl:", err.Error())
+	}
+	if err := slippage.Load(dataFile(slippageFile)); err != nil {
+		log.Fatalln("could not load slippage:", err.Error())
+	}
+	openAlerts(ctx)
 
 	// ---- TEST ------------------------------------------------------
 
@@ -227,69 +182,38 @@ func main() {
 	if tickers, err = E.GetAllTickers(); err != nil {
 		log.Fatalln("failed to update tickers:", err.Error())
 	}
-	_ = err
 
-	if all {
-		for asset := range balance.Balances {
-			free := balance.Balances[asset].Free * 0.99
-			_pair, err := E.Pair(asset + "USDT")
-			if err == nil {
-				free *= tickers[_pair.Name]
-			}
-			if size > 0 && size < free {
-				free = size
-			}
-			if minimum > free {
-				continue
-			}
-			assets = append(assets, asset)
-		}
-	}
-	for _, e := range except {
-		for i, t := range assets {
-			if e == t {
-				assets = append(assets[:i], assets[i+1:]...)
-			}
-		}
-	}
-
-	if len(assets) == 0 {
-		log.Fatalln("no assets found")
+	if err := selectAssets(); err != nil {
+		log.Fatalln(err.Error())
 	}
-	if all {
-		log.Println("found assets", assets)
-	} else {
-		log.Println("assets", assets)
-	}
-
 	mapSets()
-	pairs := SetMapList()
-
-	for _, e := range except {
-		for i, p := range pairs {
-			v, _ := E.Pair(p)
-			if e == v.Base || e == v.Quote {
-				pairs = append(pairs[:i], pairs[i+1:]...)
-			}
-		}
-	}
-
-	if len(pairs) > limit {
-		pairs = pairs[:limit]
-	}
+	pairs := selectPairs()
 
 	log.Printf("connecting to %d orderbooks --> %s", len(pairs), pairs)
 
 	// auto updates
 	updates := time.NewTicker(time.Hour)
 	// handler channels
-	var checkC = make(chan string, len(pairs))
+	var notify = orderbook.NewNotifier()
+	var dash *dashboard
+	var redraw <-chan time.Time
+	if screen {
+		dash = newDashboard(notify)
+		redraw = time.NewTicker(dashboardRefresh).C
+	}
 	var orderC = make(chan OrderSet, 1)
+	var scanDone = make(chan bool)
+
+	if addr := config.Cfg.Metrics.Listen; addr != "" {
+		serveMetrics(ctx, addr, notify)
+	}
+	updateMetrics()
 
 	go func() {
+		defer close(scanDone)
 		for {
 			select {
-			case <-shutdown:
+			case <-ctx.Done():
 				return
 			//
 			// update tickers and balance
@@ -302,151 +226,361 @@ func main() {
 				if err := E.UpdateBalance(); err != nil {
 					log.Println("failed to uodate balance:", err.Error())
 				}
+				st := notify.Stats()
+				log.Printf("book updates %d, coalesced %d, dropped wakeups %d, scanned %d, pending %d\n",
+					st.Updates, st.Coalesced, st.Dropped, st.Drained, st.Pending)
+				for _, u := range E.Usage() {
+					log.Printf("rate limit %s used %d/%d\n", u.Name, u.Used, u.Max)
+				}
+				today := pnl.Today()
+				log.Printf("today %d trades, %.1f%% wins, pnl %f USDT, fees %f USDT\n",
+					today.Trades, today.WinRate(), today.PnL, today.Fees)
+				logConfirmStats()
+				updateMetrics()
+				if reason, ok := risk.Halted(); ok {
+					log.Println("trading halted:", reason)
+				}
 
 			//
 			// check arbitrage opportunities
 			//
-			case name := <-checkC:
-				// continue if to early
-				if time.Now().Before(lastTrade) {
-					continue
+			case <-notify.C:
+				for _, name := range notify.Drain() {
+					updated, routes := notify.Updated(name), executed+failed
+					checkArbitrage(ctx, name)
+					// routes would add their execution time
+					if executed+failed == routes {
+						scanLatency.Observe(time.Since(updated).Seconds())
+					}
+					if config.Cfg.Episodes.Threshold > 0 {
+						trackEpisodes(name)
+					}
 				}
 
-				// loop throu all possible routes
-				pair, _ := E.Pair(name)
-				sets := SetsMap[pair]
-				for _, set := range sets {
-					for _, asset := range assets {
-						if asset != set.asset {
-							continue
-						}
-
-						free := balance.Balances[asset].Free * 0.9
-						_pair, err := E.Pair(asset + "USDT")
-						if err == nil {
-							free *= tickers[_pair.Name]
-						}
-						if size > 0 && size < free {
-							free = size
-						}
-						if minimum > free {
-							continue
-						}
+			//
+			// draw dashboard
+			//
+			case <-redraw:
+				dash.draw(os.Stdout)
 
-						// TODO:
-						// make this concurrent?
-						//
-						if o := set.calcStepProfits(size); o != nil {
-							if time.Now().Before(lastTrade) {
-								continue
-							}
-							lastTrade = time.Now().Add(30 * time.Second)
-
-							qty := o.initial
-							var resp float64
-							var msg string
-							var err error
-							for i, side := range o.route {
-
-								tries := 0
-								for 5 > tries {
-									// prepare order message
-									if tries == 0 {
-										msg = fmt.Sprintf("%-6s %-12f     %-12s  %%s\n", Side[side], qty, o.pair[i].Name)
-									} else {
-										msg = fmt.Sprintf("%-6s %-12f     %-12s  %%s\n", "RETRY", qty, o.pair[i].Name)
-									}
-									if side == 0 {
-										resp, err = E.SendMarket(o.pair[i].Name, Side[side], 0, qty)
-									} else {
-										resp, err = E.SendMarket(o.pair[i].Name, Side[side], qty, 0)
-									}
-									if resp != 0 {
-										qty = resp
-									}
-									if err == nil {
-										if i != 2 {
-											log.Printf(msg, "ok")
-										}
-										break
-									}
-									if i == 0 {
-										lastTrade = time.Now().Add(5 * time.Minute)
-										log.Printf(msg, "fail         skipping trade. we failed to create o and now it would be to late, cause this is time sensitive.")
-										return
-									}
-									tries++
-									log.Printf(msg, "fail         "+err.Error())
-								}
-								// exit program if we get here. > 5 tries
-								if err != nil {
-									log.Printf(msg, "fail         exiting too many tries")
-									log.Fatalln(err.Error())
-								}
-							}
-							// final results here
-							log.Printf(msg, fmt.Sprintf("%f (%5.2f%%)", qty-o.initial, (qty/o.initial)*100-100))
-
-							// update balance
-							tries := 0
-							delay := 100 * time.Microsecond
-							for 5 > tries {
-								if err = E.UpdateBalance(); err == nil {
-									break
-								}
-								log.Println("ERROR:", err.Error())
-								time.Sleep(delay)
-								delay *= 3
-								tries++
-							}
-							if err != nil {
-								log.Fatalln(err.Error())
-							}
-							// success! paus trading for a minute
-							lastTrade = time.Now().Add(5 * time.Minute)
-						}
-					}
-				}
+			//
+			// control api requests
+			//
+			case req := <-controlC:
+				req.run()
 
 			//
 			// send orders
 			//
 			case o := <-orderC:
 				log.Println("<-orderC", o)
-			default:
 			}
 		}
 	}()
 
 	// subscribe to orderbooks
 	for _, pair := range pairs {
+		if err := subscribe(ctx, pair, notify); err != nil {
+			log.Printf("could not subscribe to %s: %v\n", pair, err)
+		}
+	}
 
-		if obdiff {
-			go E.StreamBookDiff(pair, shutdown, checkC)
+	// control api changes subscriptions from the scanner once they are all made
+	if c := config.Cfg.Control; c.Listen != "" {
+		if c.Token == "" || c.Token == "CHANGE_ME" {
+			log.Println("control api needs a Token other than the example one, not serving it")
 		} else {
-			go E.StreamBookDepth(pair, shutdown, checkC)
+			serveControl(ctx, c.Listen, c.Token, notify)
 		}
 	}
 
 	log.Println("running...")
+	alert.Send(alert.Start, "started", "%s on %s, assets %v, %d books, target %.2f%%, size %v, dry run %v, scan only %v",
+		appName, E.GetName(), assets, len(streamed), target, size, dryrun, scanOnly)
+
+	<-ctx.Done()
+
+	// wait for in-flight route to finish before closing streams
+	<-scanDone
+	if screen {
+		utils.LogToStderr()
+	}
+	log.Println("closing streams...")
+	if err := E.Close(); err != nil {
+		log.Println("failed to close streams:", err.Error())
+	}
 
-	<-shutdown
+	st := notify.Stats()
+	log.Printf("uptime %v, book updates %d, opportunities %d, routes executed %d, failed %d\n",
+		time.Since(started).Round(time.Second), st.Updates, found, executed, failed)
+	logConfirmStats()
+	alert.Send(alert.Stop, "stopped", "uptime %v, opportunities %d, routes executed %d, failed %d",
+		time.Since(started).Round(time.Second), found, executed, failed)
+	alert.Close()
+	journal.Close()
+	episodes.Close()
+	utils.CloseLog()
 }
 
-// HandleInterrupt securly exits bot
-func HandleInterrupt() {
-	interrupt := make(chan os.Signal)
-	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+// checkArbitrage looks for opportunities in all sets containing pair name
+// and executes the most profitable route. no new routes are started once
+// ctx is done, but a route already in flight is finished
+func checkArbitrage(ctx context.Context, name string) {
+	// return if to early
+	if time.Now().Before(lastTrade) {
+		return
+	}
 
-	go func() {
+	// loop throu all possible routes
+	pair, _ := E.Pair(name)
+	sets := SetsMap[pair]
+	for _, set := range sets {
+		for _, asset := range assets {
+			if asset != set.asset {
+				continue
+			}
+
+			free := balance.Balances[asset].Free * 0.9
+			_pair, err := E.Pair(asset + "USDT")
+			if err == nil {
+				free *= tickers[_pair.Name]
+			}
+			if size > 0 && size < free {
+				free = size
+			}
+			if minimum > free {
+				continue
+			}
+
+			// TODO:
+			// make this concurrent?
+			//
+			// opportunities are ignored until they persisted
+			o := set.calcStepProfits(size)
+			if o == nil {
+				confirm.Gone(set.Name())
+			} else if confirm.Seen(o.Name()) {
+				found++
+				opportunities.Inc(o.asset)
+				o.id = newRouteID()
+				journalOpportunity(o)
+				if time.Now().Before(lastTrade) {
+					journalDecision(o, journal.Skip, "cooldown", "")
+					continue
+				}
+				if ctx.Err() != nil {
+					journalDecision(o, journal.Skip, "shutting down", "")
+					continue
+				}
+				if scanOnly {
+					journalDecision(o, journal.Skip, "scan only", "")
+					continue
+				}
+				if err := risk.Check(usdValue(o.asset, o.initial), pnl.Today().PnL, pnl.StrandedValue(tickers)); err != nil {
+					reason := "risk"
+					var t *risk.Trip
+					if errors.As(err, &t) {
+						reason = "risk " + t.Limit
+					}
+					journalDecision(o, journal.Skip, reason, err.Error())
+					continue
+				}
+				if confirm.Policy().BookTicker {
+					ok, details := confirmBookTicker(o)
+					confirm.BookTicker(ok)
+					if !ok {
+						journalDecision(o, journal.Skip, "book ticker", details)
+						continue
+					}
+				}
+				journalDecision(o, journal.Execute, "target", fmt.Sprintf("%.2f%% >= target %.2f%% + slippage %.2f%%", o.perc, target, o.margin))
+				lastTrade = time.Now().Add(30 * time.Second)
+
+				qty := o.initial
+				var trade *orders.Trade
+				var fills [3]*orders.Trade
+				var err error
+				for i, side := range o.route {
+
+					tries := 0
+					for 5 > tries {
+						fields := []interface{}{"route", o.id, "leg", i, "side", Side[side], "pair", o.pair[i].Name, "amount", qty, "try", tries}
+						req := journal.OrderRequest{Pair: o.pair[i].Name, Side: Side[side], ClientID: o.clientID(i)}
+						if side == 0 {
+							req.Quote = qty
+						} else {
+							req.Amount = qty
+						}
+						start := time.Now()
+						trade, err = sendMarket(req)
+						took := time.Since(start)
+						orderLatency.Observe(took.Seconds(), strconv.Itoa(i))
+						journalOrder(o, i, req, trade, took, err)
+						fields = append(fields, "latency_ms", logger.Millis(took))
+						if trade != nil && trade.Received != 0 {
+							qty = trade.Received
+							fields = append(fields, "price", trade.Price, "received", qty)
+						}
+						if err == nil {
+							fills[i] = trade
+							tradeLog.Info("order", fields...)
+							break
+						}
+						fields = append(fields, "err", err)
+						// an order of unknown status halts below, even on the first leg
+						if i == 0 && !errors.Is(err, client.ErrOrderUnknown) {
+							failed++
+							routeResults.Inc(o.asset, "failed")
+							journalResult(o, 0, err)
+							recordExecution(o, 0, err)
+							lastTrade = time.Now().Add(5 * time.Minute)
+							// too late to retry the first leg, the opportunity is time sensitive
+							tradeLog.Error("order failed, skipping route", fields...)
+							return
+						}
+						tries++
+						tradeLog.Warn("order failed", fields...)
+						if !client.IsRetryable(err) {
+							break
+						}
+						if client.ClassOf(err) == client.RateLimited {
+							// sending again at once runs into an ip ban
+							wait := client.RetryAfter(err)
+							if wait == 0 {
+								wait = time.Second << uint(tries-1)
+							}
+							if wait > maxRateLimitWait {
+								break
+							}
+							tradeLog.Warn("rate limited, waiting", "route", o.id, "leg", i, "wait_ms", logger.Millis(wait))
+							time.Sleep(wait)
+						}
+					}
+					// halt trading if we get here. > 5 tries or not retryable
+					if err != nil {
+						failed++
+						routeResults.Inc(o.asset, "failed")
+						legErr := fmt.Errorf("leg %d: %w", i, err)
+						journalResult(o, 0, legErr)
+						recordExecution(o, 0, legErr)
+						pnl.Strand(o.spends(i), qty)
+						// book what is left at current prices, so the daily loss limit sees the loss
+						pnl.Record(pnl.Trade{
+							Time:     time.Now(),
+							Route:    o.Name(),
+							Asset:    o.asset,
+							Initial:  o.initial,
+							Final:    pnl.Value(tickers, o.spends(i), o.asset, qty),
+							Expected: o.profit,
+							Fees:     o.fees(fills),
+						}, tickers)
+						if err := pnl.Save(); err != nil {
+							log.Println("could not save pnl:", err.Error())
+						}
+						updateMetrics()
+						tradeLog.Error("route failed, halting", "route", o.id, "leg", i, "pair", o.pair[i].Name, "class", client.ClassOf(err), "tries", tries, "left", qty, "asset", o.spends(i), "err", err)
+						risk.Halt(fmt.Sprintf("route %s failed on leg %d with %f %s left: %v", o.id, i, qty, o.spends(i), err))
+						return
+					}
+				}
+				// final results here
+				tradeLog.Info("result", "route", o.id, "asset", o.asset, "amount", o.initial, "final", qty, "pnl", qty-o.initial, "perc", (qty/o.initial)*100-100, "expected", o.perc)
+				journalResult(o, qty, nil)
+				recordExecution(o, qty, nil)
+				executed++
+				routeResults.Inc(o.asset, "executed")
+				o.recordSlippage(fills)
+				pnl.Record(pnl.Trade{
+					Time:     time.Now(),
+					Route:    o.Name(),
+					Asset:    o.asset,
+					Initial:  o.initial,
+					Final:    qty,
+					Expected: o.profit,
+					Fees:     o.fees(fills),
+				}, tickers)
+				if err := pnl.Save(); err != nil {
+					log.Println("could not save pnl:", err.Error())
+				}
+				// simulated losses do not count against live trading
+				if !dryrun {
+					risk.Result(qty - o.initial)
+				}
 
-		select {
-		case <-interrupt:
-			break
+				// update balance
+				tries := 0
+				delay := 100 * time.Microsecond
+				for 5 > tries {
+					if err = E.UpdateBalance(); err == nil {
+						break
+					}
+					log.Println("ERROR:", err.Error())
+					time.Sleep(delay)
+					delay *= 3
+					tries++
+				}
+				if err != nil {
+					risk.Halt("could not update balance: " + err.Error())
+				}
+				updateMetrics()
+				// success! paus trading for a minute
+				lastTrade = time.Now().Add(5 * time.Minute)
+			}
 		}
+	}
+}
+
+// selectAssets adds assets with a balance if all is set and removes except
+func selectAssets() error {
+	if all {
+		for asset := range balance.Balances {
+			free := balance.Balances[asset].Free * 0.99
+			_pair, err := E.Pair(asset + "USDT")
+			if err == nil {
+				free *= tickers[_pair.Name]
+			}
+			if size > 0 && size < free {
+				free = size
+			}
+			if minimum > free {
+				continue
+			}
+			assets = append(assets, asset)
+		}
+	}
+	for _, e := range except {
+		for i, t := range assets {
+			if e == t {
+				assets = append(assets[:i], assets[i+1:]...)
+			}
+		}
+	}
+
+	if len(assets) == 0 {
+		return errors.New("no assets found")
+	}
+	if all {
+		log.Println("found assets", assets)
+	} else {
+		log.Println("assets", assets)
+	}
+	return nil
+}
+
+// HandleInterrupt cancels the app context on the first signal
+// and forces exit on the second
+func HandleInterrupt(cancel context.CancelFunc) {
+	interrupt := make(chan os.Signal, 2)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-interrupt
+		log.Println("shutting down... (interrupt again to force exit)")
+		cancel()
 
-		log.Println("shutting down...")
-		close(shutdown)
+		<-interrupt
+		log.Println("forced exit")
+		os.Exit(1)
 	}()
 }
 
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/slicken/arbitrager/balance"
+	"github.com/slicken/arbitrager/metrics"
+	"github.com/slicken/arbitrager/orderbook"
+	"github.com/slicken/arbitrager/pnl"
+)
+
+var (
+	scanLatency   = metrics.NewHistogram("arbitrager_scan_latency_seconds", "time from book update to decision", metrics.DefaultBuckets)
+	opportunities = metrics.NewCounter("arbitrager_opportunities_total", "confirmed opportunities by asset", "asset")
+	routeResults  = metrics.NewCounter("arbitrager_routes_total", "routes by asset and result", "asset", "result")
+	orderLatency  = metrics.NewHistogram("arbitrager_order_latency_seconds", "market order latency by leg", metrics.DefaultBuckets, "leg")
+	pnlGauge      = metrics.NewGauge("arbitrager_pnl_usdt", "realized pnl by period", "period")
+	strandedGauge = metrics.NewGauge("arbitrager_stranded_usdt", "value of assets left by failed routes")
+	balanceGauge  = metrics.NewGauge("arbitrager_balance", "exchange balance by asset and state", "asset", "state")
+)
+
+// serveMetrics serves prometheus metrics on addr until ctx is done
+func serveMetrics(ctx context.Context, addr string, notify *orderbook.Notifier) {
+	metrics.NewGaugeFunc("arbitrager_book_age_seconds", "time since the last update of each book", "symbol", func() map[string]float64 {
+		m := make(map[string]float64)
+		for symbol, t := range notify.LastUpdates() {
+			m[symbol] = time.Since(t).Seconds()
+		}
+		return m
+	})
+	metrics.NewGaugeFunc("arbitrager_rate_limit_used", "used request weight and orders of each exchange limit", "limit", func() map[string]float64 {
+		m := make(map[string]float64)
+		for _, u := range E.Usage() {
+			m[u.Name] = float64(u.Used)
+		}
+		return m
+	})
+	metrics.NewGaugeFunc("arbitrager_rate_limit_max", "maximum of each exchange limit", "limit", func() map[string]float64 {
+		m := make(map[string]float64)
+		for _, u := range E.Usage() {
+			m[u.Name] = float64(u.Max)
+		}
+		return m
+	})
+
+	go func() {
+		log.Printf("serving metrics on http://%s/metrics\n", addr)
+		if err := metrics.Serve(ctx, addr); err != nil {
+			log.Println("metrics server failed:", err.Error())
+		}
+	}()
+}
+
+// updateMetrics sets pnl and balance gauges. called by the scanner
+// after balances and pnl change, so it never races their updates
+func updateMetrics() {
+	pnlGauge.Set(pnl.Total().PnL, "total")
+	pnlGauge.Set(pnl.Today().PnL, "today")
+	strandedGauge.Set(pnl.StrandedValue(tickers))
+	balanceGauge.Reset()
+	for asset, b := range balance.Balances {
+		balanceGauge.Set(b.Free, asset, "free")
+		balanceGauge.Set(b.Locked, asset, "locked")
+	}
+}
@@ -0,0 +1,254 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are latency buckets in seconds
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+var (
+	mu       sync.Mutex
+	registry []*metric
+)
+
+// metric is a named family of series told apart by label values
+type metric struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	// fn returns values by the value of the only label when scraped
+	fn func() map[string]float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// series is one set of label values of a metric
+type series struct {
+	values []string
+	value  float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func register(m *metric) *metric {
+	m.series = make(map[string]*series)
+	mu.Lock()
+	defer mu.Unlock()
+
+	registry = append(registry, m)
+	return m
+}
+
+// get returns the series of values. must be called with m.mu locked
+func (m *metric) get(values []string) *series {
+	if len(values) != len(m.labels) {
+		panic(fmt.Sprintf("metric %s wants %d label values, got %d", m.name, len(m.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		if m.buckets != nil {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// Counter only goes up
+type Counter struct{ m *metric }
+
+// NewCounter registers a counter with label names
+func NewCounter(name, help string, labels ...string) Counter {
+	return Counter{register(&metric{name: name, help: help, kind: "counter", labels: labels})}
+}
+
+// Inc adds 1 to the series of label values
+func (c Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v to the series of label values
+func (c Counter) Add(v float64, values ...string) {
+	c.m.mu.Lock()
+	c.m.get(values).value += v
+	c.m.mu.Unlock()
+}
+
+// Gauge goes up and down
+type Gauge struct{ m *metric }
+
+// NewGauge registers a gauge with label names
+func NewGauge(name, help string, labels ...string) Gauge {
+	return Gauge{register(&metric{name: name, help: help, kind: "gauge", labels: labels})}
+}
+
+// Set sets the series of label values to v
+func (g Gauge) Set(v float64, values ...string) {
+	g.m.mu.Lock()
+	g.m.get(values).value = v
+	g.m.mu.Unlock()
+}
+
+// Reset removes all series, eg. before setting balances again
+func (g Gauge) Reset() {
+	g.m.mu.Lock()
+	g.m.series = make(map[string]*series)
+	g.m.mu.Unlock()
+}
+
+// NewGaugeFunc registers a gauge with one label whose values are read from fn when scraped
+func NewGaugeFunc(name, help, label string, fn func() map[string]float64) {
+	register(&metric{name: name, help: help, kind: "gauge", labels: []string{label}, fn: fn})
+}
+
+// Histogram counts observations in buckets
+type Histogram struct{ m *metric }
+
+// NewHistogram registers a histogram with upper bounds of buckets and label names
+func NewHistogram(name, help string, buckets []float64, labels ...string) Histogram {
+	return Histogram{register(&metric{name: name, help: help, kind: "histogram", labels: labels, buckets: buckets})}
+}
+
+// Observe adds v to the series of label values
+func (h Histogram) Observe(v float64, values ...string) {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+
+	s := h.m.get(values)
+	for i, le := range h.m.buckets {
+		if v <= le {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// Write writes all metrics in the prometheus text format
+func Write(w io.Writer) error {
+	mu.Lock()
+	list := append([]*metric(nil), registry...)
+	mu.Unlock()
+
+	b := bufio.NewWriter(w)
+	for _, m := range list {
+		m.write(b)
+	}
+	return b.Flush()
+}
+
+func (m *metric) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, escape(m.help, false), m.name, m.kind)
+	if m.fn != nil {
+		values := m.fn()
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, labels(m.labels, []string{k}, "", 0), format(values[k]))
+		}
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]string, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := m.series[k]
+		if m.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, labels(m.labels, s.values, "", 0), format(s.value))
+			continue
+		}
+		for i, le := range m.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, labels(m.labels, s.values, "le", le), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, labels(m.labels, s.values, "le", math.Inf(1)), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, labels(m.labels, s.values, "", 0), format(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, labels(m.labels, s.values, "", 0), s.count)
+	}
+}
+
+// labels returns {name="value",...} with an optional le bucket label
+func labels(names, values []string, le string, bound float64) string {
+	var pairs []string
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+escape(values[i], true)+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, le+`="`+format(bound)+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escape(s string, quote bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quote {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
+
+func format(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Handler serves the metrics
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		Write(w)
+	})
+}
+
+// Serve serves the metrics on addr under /metrics until ctx is done or it fails
+func Serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(c)
+	}()
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package orderbook
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Notifier marks books dirty on update and wakes up the scanner
+// without ever blocking the stream reader. Many updates to the same
+// symbol between two scans are coalesced into a single entry.
+type Notifier struct {
+	C <-chan struct{}
+
+	c     chan struct{}
+	mu    sync.Mutex
+	dirty map[string]struct{}
+	order []string
+	// updated holds the time of the last update of each symbol
+	updated map[string]time.Time
+
+	updates   uint64
+	coalesced uint64
+	dropped   uint64
+	drained   uint64
+}
+
+// NotifyStats holds notifier counters
+type NotifyStats struct {
+	// Updates is the number of book updates received
+	Updates uint64
+	// Coalesced is the number of updates merged into an already dirty symbol
+	Coalesced uint64
+	// Dropped is the number of wake-ups skipped because one was already pending
+	Dropped uint64
+	// Drained is the number of symbols handed to the scanner
+	Drained uint64
+	// Pending is the number of dirty symbols waiting to be scanned
+	Pending int
+}
+
+// NewNotifier returns a new Notifier
+func NewNotifier() *Notifier {
+	c := make(chan struct{}, 1)
+	return &Notifier{
+		C:       c,
+		c:       c,
+		dirty:   make(map[string]struct{}),
+		updated: make(map[string]time.Time),
+	}
+}
+
+// Notify marks symbol as dirty. It never blocks
+func (n *Notifier) Notify(symbol string) {
+	atomic.AddUint64(&n.updates, 1)
+
+	n.mu.Lock()
+	n.updated[symbol] = time.Now()
+	if _, ok := n.dirty[symbol]; ok {
+		n.mu.Unlock()
+		atomic.AddUint64(&n.coalesced, 1)
+		return
+	}
+	n.dirty[symbol] = struct{}{}
+	n.order = append(n.order, symbol)
+	n.mu.Unlock()
+
+	select {
+	case n.c <- struct{}{}:
+	default:
+		atomic.AddUint64(&n.dropped, 1)
+	}
+}
+
+// Drain returns all dirty symbols in the order they were marked and clears the set
+func (n *Notifier) Drain() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	list := n.order
+	n.order = make([]string, 0, len(list))
+	for _, s := range list {
+		delete(n.dirty, s)
+	}
+	atomic.AddUint64(&n.drained, uint64(len(list)))
+	return list
+}
+
+// Remove forgets symbol, eg. after its book is unsubscribed
+func (n *Notifier) Remove(symbol string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.updated, symbol)
+}
+
+// Updated returns the time of the last update of symbol
+func (n *Notifier) Updated(symbol string) time.Time {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.updated[symbol]
+}
+
+// LastUpdates returns the time of the last update of every symbol
+func (n *Notifier) LastUpdates() map[string]time.Time {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	m := make(map[string]time.Time, len(n.updated))
+	for k, v := range n.updated {
+		m[k] = v
+	}
+	return m
+}
+
+// Stats returns a snapshot of the notifier counters
+func (n *Notifier) Stats() NotifyStats {
+	n.mu.Lock()
+	pending := len(n.order)
+	n.mu.Unlock()
+
+	return NotifyStats{
+		Updates:   atomic.LoadUint64(&n.updates),
+		Coalesced: atomic.LoadUint64(&n.coalesced),
+		Dropped:   atomic.LoadUint64(&n.dropped),
+		Drained:   atomic.LoadUint64(&n.drained),
+		Pending:   pending,
+	}
+}
@@ -0,0 +1,111 @@
+package orderbook
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNotifier(t *testing.T) {
+	tests := []struct {
+		name string
+		// steps are symbols to notify, "drain" drains and "wake" reads C
+		steps  []string
+		drains [][]string
+		want   NotifyStats
+	}{
+		{
+			name:   "coalesces updates of a dirty symbol",
+			steps:  []string{"BTCUSDT", "BTCUSDT", "BTCUSDT", "drain"},
+			drains: [][]string{{"BTCUSDT"}},
+			want:   NotifyStats{Updates: 3, Coalesced: 2, Dropped: 0, Drained: 1},
+		},
+		{
+			name:   "keeps the order symbols were marked in",
+			steps:  []string{"ETHUSDT", "BTCUSDT", "ETHUSDT", "BNBUSDT", "drain"},
+			drains: [][]string{{"ETHUSDT", "BTCUSDT", "BNBUSDT"}},
+			want:   NotifyStats{Updates: 4, Coalesced: 1, Dropped: 2, Drained: 3},
+		},
+		{
+			name:   "drops wake-ups while one is pending",
+			steps:  []string{"A", "B", "C", "wake", "D", "E"},
+			want:   NotifyStats{Updates: 5, Coalesced: 0, Dropped: 3, Pending: 5},
+			drains: nil,
+		},
+		{
+			name:   "marks a symbol dirty again after a drain",
+			steps:  []string{"A", "drain", "wake", "A", "A", "drain"},
+			drains: [][]string{{"A"}, {"A"}},
+			want:   NotifyStats{Updates: 3, Coalesced: 1, Dropped: 0, Drained: 2},
+		},
+		{
+			name:   "drain without updates",
+			steps:  []string{"drain"},
+			drains: [][]string{{}},
+			want:   NotifyStats{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := NewNotifier()
+			var drains [][]string
+			for _, s := range tt.steps {
+				switch s {
+				case "drain":
+					drains = append(drains, n.Drain())
+				case "wake":
+					select {
+					case <-n.C:
+					default:
+						t.Fatal("no wake-up pending")
+					}
+				default:
+					n.Notify(s)
+				}
+			}
+			if len(drains) != len(tt.drains) {
+				t.Fatalf("%d drains, want %d", len(drains), len(tt.drains))
+			}
+			for i := range drains {
+				if strings.Join(drains[i], ",") != strings.Join(tt.drains[i], ",") {
+					t.Errorf("drain %d = %v, want %v", i, drains[i], tt.drains[i])
+				}
+			}
+			if got := n.Stats(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Stats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotifierNeverBlocks(t *testing.T) {
+	n := NewNotifier()
+	for i := 0; i < 10000; i++ {
+		n.Notify(string(rune('A' + i%26)))
+	}
+	if s := n.Stats(); s.Pending != 26 || s.Coalesced != 10000-26 {
+		t.Errorf("Stats() = %+v, want 26 pending and %d coalesced", s, 10000-26)
+	}
+	if len(n.C) != 1 {
+		t.Errorf("%d wake-ups pending, want 1", len(n.C))
+	}
+}
+
+func TestNotifierUpdated(t *testing.T) {
+	n := NewNotifier()
+	n.Notify("A")
+	if n.Updated("A").IsZero() {
+		t.Fatal("Updated(A) is zero after Notify")
+	}
+	n.Drain()
+	if n.Updated("A").IsZero() {
+		t.Error("Updated(A) is zero after Drain")
+	}
+	n.Remove("A")
+	if !n.Updated("A").IsZero() {
+		t.Error("Updated(A) is set after Remove")
+	}
+	if len(n.LastUpdates()) != 0 {
+		t.Errorf("LastUpdates() = %v after Remove", n.LastUpdates())
+	}
+}
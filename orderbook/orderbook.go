@@ -85,13 +85,18 @@ func Delete(name string) {
 	delete(Orderbook, name)
 }
 
-// Reset all Asks and Bids
+// Reset all Asks and Bids. the maps are cleared in place, so readers
+// of b.Asks and b.Bids never race with a reset
 func (b *Book) Reset() {
 	mu.Lock()
 	defer mu.Unlock()
 
-	b.Asks = make(asks, DEPTH)
-	b.Bids = make(bids, DEPTH)
+	for k := range b.Asks {
+		delete(b.Asks, k)
+	}
+	for k := range b.Bids {
+		delete(b.Bids, k)
+	}
 }
 
 // Reset all Asks
@@ -212,3 +217,30 @@ func (v bids) GetDepthPrice(amount float64) float64 {
 	}
 	return -1
 }
+
+// Snapshot is a copy of the top levels of a Book
+type Snapshot struct {
+	Name        string    `json:"pair"`
+	Bids        []Item    `json:"bids"`
+	Asks        []Item    `json:"asks"`
+	LastUpdated time.Time `json:"last_updated"`
+}
+
+// Snapshot returns a copy of the top depth levels of Bids and Asks
+func (b *Book) Snapshot(depth int) Snapshot {
+	s := Snapshot{
+		Name: b.Name,
+		Bids: b.Bids.Get(),
+		Asks: b.Asks.Get(),
+	}
+	if len(s.Bids) > depth {
+		s.Bids = s.Bids[:depth]
+	}
+	if len(s.Asks) > depth {
+		s.Asks = s.Asks[:depth]
+	}
+	mu.Lock()
+	s.LastUpdated = b.LastUpdated
+	mu.Unlock()
+	return s
+}
@@ -20,6 +20,35 @@ type Order struct {
 	Stop   float64
 }
 
+// Trade is the result of an executed order
+type Trade struct {
+	ID       int64
+	ClientID string
+	Pair     string
+	Side     string
+	Status   string
+	// Amount and Quote are the requested base and quote amounts
+	Amount float64
+	Quote  float64
+	// Filled and Cost are the executed base and quote amounts
+	Filled float64
+	Cost   float64
+	// Price is the average fill price
+	Price float64
+	// Received is what we got after commission paid in the received asset
+	Received float64
+	Fills    []Fill
+	Time     time.Time
+}
+
+// Fill is a part of an executed order
+type Fill struct {
+	Price           float64
+	Qty             float64
+	Commission      float64
+	CommissionAsset string
+}
+
 // Add order to memory
 func Add(id int64, symbol, side string, amount, price float64) {
 	order := &Order{
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/slicken/arbitrager/orders"
+	"github.com/slicken/arbitrager/pnl"
+)
+
+const pnlFile = "pnl.json"
+
+// spends returns the asset spent on leg
+func (s Set) spends(leg int) string {
+	if s.route[leg] == buy {
+		return s.pair[leg].Quote
+	}
+	return s.pair[leg].Base
+}
+
+// receives returns the asset received on leg
+func (s Set) receives(leg int) string {
+	if s.route[leg] == buy {
+		return s.pair[leg].Base
+	}
+	return s.pair[leg].Quote
+}
+
+// fees returns commissions of trades not paid in the received asset,
+// those are not included in the route amounts
+func (s Set) fees(trades [3]*orders.Trade) map[string]float64 {
+	m := make(map[string]float64)
+	for i, t := range trades {
+		if t == nil {
+			continue
+		}
+		for _, f := range t.Fills {
+			if f.CommissionAsset != s.receives(i) {
+				m[f.CommissionAsset] += f.Commission
+			}
+		}
+	}
+	return m
+}
+
+// runPnl prints the pnl ledger
+func runPnl(args []string) {
+	fs := flag.NewFlagSet("pnl", flag.ExitOnError)
+	file := fs.String("f", pnlFile, "pnl file")
+	live := fs.Bool("live", false, "connect to exchange to value stranded assets")
+	fs.Parse(args)
+
+	if err := pnl.Load(*file, "USDT"); err != nil {
+		fmt.Println("could not load pnl:", err)
+		os.Exit(1)
+	}
+	if *live {
+		connect()
+		var err error
+		if tickers, err = E.GetAllTickers(); err != nil {
+			fmt.Println("could not get tickers:", err)
+			os.Exit(1)
+		}
+	}
+	pnl.Report(os.Stdout, tickers)
+}
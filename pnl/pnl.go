@@ -0,0 +1,306 @@
+package pnl
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/slicken/arbitrager/config"
+)
+
+// Stats holds results in the reporting currency
+type Stats struct {
+	Trades int
+	Wins   int
+	// Amount is the result in the asset itself, for asset stats only
+	Amount   float64 `json:",omitempty"`
+	PnL      float64
+	Fees     float64
+	Expected float64
+	Slippage float64
+}
+
+// WinRate returns percentage of winning trades
+func (s *Stats) WinRate() float64 {
+	if s.Trades == 0 {
+		return 0
+	}
+	return float64(s.Wins) / float64(s.Trades) * 100
+}
+
+// AvgSlippage returns average of expected minus realized profit per trade
+func (s *Stats) AvgSlippage() float64 {
+	if s.Trades == 0 {
+		return 0
+	}
+	return s.Slippage / float64(s.Trades)
+}
+
+func (s *Stats) add(pnl, fees, expected float64) {
+	s.Trades++
+	if pnl > 0 {
+		s.Wins++
+	}
+	s.PnL += pnl
+	s.Fees += fees
+	s.Expected += expected
+	s.Slippage += expected - pnl
+}
+
+// Ledger holds realized results of all sessions
+type Ledger struct {
+	Currency string
+	Total    Stats
+	Routes   map[string]*Stats
+	Assets   map[string]*Stats
+	Days     map[string]*Stats
+	// Equity is the cumulative pnl, Peak its highest value
+	Equity      float64
+	Peak        float64
+	MaxDrawdown float64
+	// Stranded holds assets left by routes that did not complete
+	Stranded map[string]float64
+	Updated  time.Time
+}
+
+// Trade is a completed route
+type Trade struct {
+	Time  time.Time
+	Route string
+	Asset string
+	// Initial and Final amounts of Asset
+	Initial float64
+	Final   float64
+	// Expected profit in Asset
+	Expected float64
+	// Fees paid in other assets than the received ones, eg. BNB
+	Fees map[string]float64
+}
+
+var (
+	mu       sync.Mutex
+	filename string
+	// L is the loaded ledger
+	L = newLedger("USDT")
+)
+
+func newLedger(currency string) *Ledger {
+	return &Ledger{
+		Currency: currency,
+		Routes:   make(map[string]*Stats),
+		Assets:   make(map[string]*Stats),
+		Days:     make(map[string]*Stats),
+		Stranded: make(map[string]float64),
+	}
+}
+
+// Load reads the ledger from file, or starts a new one in currency
+func Load(file, currency string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	filename = file
+	L = newLedger(currency)
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil
+	}
+	if err := config.ReadFile(L, file); err != nil {
+		return err
+	}
+	if L.Currency == "" {
+		L.Currency = currency
+	}
+	return nil
+}
+
+// Save writes the ledger to file
+func Save() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if filename == "" {
+		return nil
+	}
+	return config.WriteFile(L, filename)
+}
+
+// Value returns amount of asset in currency using tickers, crossing over USDT if needed.
+// it returns 0 if there is no price
+func Value(tickers map[string]float64, asset, currency string, amount float64) float64 {
+	if asset == currency || amount == 0 {
+		return amount
+	}
+	if p, ok := tickers[asset+currency]; ok {
+		return amount * p
+	}
+	if p, ok := tickers[currency+asset]; ok && p != 0 {
+		return amount / p
+	}
+	if currency != "USDT" && asset != "USDT" {
+		if usdt := Value(tickers, asset, "USDT", amount); usdt != 0 {
+			return Value(tickers, "USDT", currency, usdt)
+		}
+	}
+	return 0
+}
+
+// Record adds a completed route to the ledger
+func Record(t Trade, tickers map[string]float64) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	cur := L.Currency
+	pnl := Value(tickers, t.Asset, cur, t.Final-t.Initial)
+	expected := Value(tickers, t.Asset, cur, t.Expected)
+	var fees float64
+	for asset, amount := range t.Fees {
+		fees += Value(tickers, asset, cur, amount)
+	}
+	// fees paid in other assets are not in Final
+	pnl -= fees
+
+	L.Total.add(pnl, fees, expected)
+	stats(L.Routes, t.Route).add(pnl, fees, expected)
+	stats(L.Days, t.Time.Format("20060102")).add(pnl, fees, expected)
+	a := stats(L.Assets, t.Asset)
+	a.add(pnl, fees, expected)
+	a.Amount += t.Final - t.Initial
+
+	L.Equity += pnl
+	if L.Equity > L.Peak {
+		L.Peak = L.Equity
+	}
+	if dd := L.Peak - L.Equity; dd > L.MaxDrawdown {
+		L.MaxDrawdown = dd
+	}
+	L.Updated = time.Now()
+}
+
+// Strand records amount of asset left over by a route that did not complete
+func Strand(asset string, amount float64) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	L.Stranded[asset] += amount
+	L.Updated = time.Now()
+}
+
+// ClearStranded removes assets from the stranded ones, all if none are given,
+// eg. after they were sold by hand. it returns the removed amounts
+func ClearStranded(assets ...string) map[string]float64 {
+	mu.Lock()
+	defer mu.Unlock()
+
+	cleared := make(map[string]float64)
+	for asset, amount := range L.Stranded {
+		if len(assets) > 0 && !contains(assets, asset) {
+			continue
+		}
+		cleared[asset] = amount
+		delete(L.Stranded, asset)
+	}
+	if len(cleared) > 0 {
+		L.Updated = time.Now()
+	}
+	return cleared
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// StrandedValue returns value of all stranded assets in the ledger currency
+func StrandedValue(tickers map[string]float64) float64 {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var total float64
+	for asset, amount := range L.Stranded {
+		total += Value(tickers, asset, L.Currency, amount)
+	}
+	return total
+}
+
+// Total returns stats of all trades
+func Total() Stats {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return L.Total
+}
+
+// Today returns stats of today
+func Today() Stats {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if s, ok := L.Days[time.Now().Format("20060102")]; ok {
+		return *s
+	}
+	return Stats{}
+}
+
+func stats(m map[string]*Stats, key string) *Stats {
+	s, ok := m[key]
+	if !ok {
+		s = new(Stats)
+		m[key] = s
+	}
+	return s
+}
+
+// Report writes the ledger to w. tickers values stranded assets, may be nil
+func Report(w io.Writer, tickers map[string]float64) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	cur := L.Currency
+	fmt.Fprintf(w, "%-24s %7s %7s %14s %12s %14s %14s\n", "", "trades", "win%", "pnl "+cur, "fees", "expected", "avg slippage")
+	line := func(name string, s *Stats) {
+		fmt.Fprintf(w, "%-24s %7d %6.1f%% %14f %12f %14f %14f\n",
+			name, s.Trades, s.WinRate(), s.PnL, s.Fees, s.Expected, s.AvgSlippage())
+	}
+	line("total", &L.Total)
+	fmt.Fprintf(w, "%-24s %14f (peak %f, max drawdown %f)\n", "equity", L.Equity, L.Peak, L.MaxDrawdown)
+
+	fmt.Fprintln(w, "\nper day")
+	for _, k := range keys(L.Days) {
+		line(k, L.Days[k])
+	}
+	fmt.Fprintln(w, "\nper asset")
+	for _, k := range keys(L.Assets) {
+		line(fmt.Sprintf("%s %f", k, L.Assets[k].Amount), L.Assets[k])
+	}
+	fmt.Fprintln(w, "\nper route")
+	for _, k := range keys(L.Routes) {
+		line(k, L.Routes[k])
+	}
+
+	if len(L.Stranded) > 0 {
+		fmt.Fprintln(w, "\nstranded")
+		var total float64
+		for asset, amount := range L.Stranded {
+			v := Value(tickers, asset, cur, amount)
+			total += v
+			fmt.Fprintf(w, "%-24s %14f %14f %s\n", asset, amount, v, cur)
+		}
+		fmt.Fprintf(w, "%-24s %14s %14f %s\n", "total", "", total, cur)
+	}
+}
+
+func keys(m map[string]*Stats) []string {
+	list := make([]string, 0, len(m))
+	for k := range m {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,232 @@
+package pnl
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var tickers = map[string]float64{
+	"BTCUSDT": 20000,
+	"ETHUSDT": 1000,
+	"BNBUSDT": 300,
+	"USDTTRY": 10,
+}
+
+// equal compares floats within rounding errors
+func equal(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		asset    string
+		currency string
+		amount   float64
+		want     float64
+	}{
+		{"same asset", "USDT", "USDT", 5, 5},
+		{"zero amount", "BTC", "USDT", 0, 0},
+		{"direct", "BTC", "USDT", 0.5, 10000},
+		{"inverse", "USDT", "BTC", 10000, 0.5},
+		{"over usdt", "ETH", "TRY", 1, 1000 * 10},
+		{"inverse over usdt", "TRY", "BTC", 200000, 1},
+		{"no price", "XRP", "USDT", 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Value(tickers, tt.asset, tt.currency, tt.amount); !equal(got, tt.want) {
+				t.Errorf("Value(%s, %s, %f) = %f, want %f", tt.asset, tt.currency, tt.amount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecord(t *testing.T) {
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1)
+	tests := []struct {
+		name   string
+		trades []Trade
+		total  Stats
+		today  Stats
+		days   int
+		equity float64
+		peak   float64
+		dd     float64
+	}{
+		{
+			name:   "win",
+			trades: []Trade{{Time: now, Route: "A", Asset: "USDT", Initial: 100, Final: 101, Expected: 1.5}},
+			total:  Stats{Trades: 1, Wins: 1, PnL: 1, Expected: 1.5, Slippage: 0.5},
+			today:  Stats{Trades: 1, Wins: 1, PnL: 1, Expected: 1.5, Slippage: 0.5},
+			days:   1,
+			equity: 1,
+			peak:   1,
+		},
+		{
+			name:   "fees in another asset",
+			trades: []Trade{{Time: now, Route: "A", Asset: "USDT", Initial: 100, Final: 101, Expected: 1, Fees: map[string]float64{"BNB": 0.001}}},
+			total:  Stats{Trades: 1, Wins: 1, PnL: 0.7, Fees: 0.3, Expected: 1, Slippage: 0.3},
+			today:  Stats{Trades: 1, Wins: 1, PnL: 0.7, Fees: 0.3, Expected: 1, Slippage: 0.3},
+			days:   1,
+			equity: 0.7,
+			peak:   0.7,
+		},
+		{
+			name:   "valued in the ledger currency",
+			trades: []Trade{{Time: now, Route: "B", Asset: "BTC", Initial: 1, Final: 1.0001, Expected: 0.0001}},
+			total:  Stats{Trades: 1, Wins: 1, PnL: 2, Expected: 2},
+			today:  Stats{Trades: 1, Wins: 1, PnL: 2, Expected: 2},
+			days:   1,
+			equity: 2,
+			peak:   2,
+		},
+		{
+			name: "drawdown",
+			trades: []Trade{
+				{Time: now, Route: "A", Asset: "USDT", Initial: 100, Final: 103, Expected: 3},
+				{Time: now, Route: "A", Asset: "USDT", Initial: 100, Final: 99, Expected: 1},
+				{Time: now, Route: "A", Asset: "USDT", Initial: 100, Final: 98, Expected: 1},
+				{Time: now, Route: "A", Asset: "USDT", Initial: 100, Final: 101, Expected: 1},
+			},
+			total:  Stats{Trades: 4, Wins: 2, PnL: 1, Expected: 6, Slippage: 5},
+			today:  Stats{Trades: 4, Wins: 2, PnL: 1, Expected: 6, Slippage: 5},
+			days:   1,
+			equity: 1,
+			peak:   3,
+			dd:     3,
+		},
+		{
+			name: "daily rollover",
+			trades: []Trade{
+				{Time: yesterday, Route: "A", Asset: "USDT", Initial: 100, Final: 90, Expected: 1},
+				{Time: now, Route: "A", Asset: "USDT", Initial: 100, Final: 102, Expected: 2},
+			},
+			total:  Stats{Trades: 2, Wins: 1, PnL: -8, Expected: 3, Slippage: 11},
+			today:  Stats{Trades: 1, Wins: 1, PnL: 2, Expected: 2},
+			days:   2,
+			equity: -8,
+			dd:     10,
+		},
+		{
+			name:   "nothing today",
+			trades: []Trade{{Time: yesterday, Route: "A", Asset: "USDT", Initial: 100, Final: 101, Expected: 1}},
+			total:  Stats{Trades: 1, Wins: 1, PnL: 1, Expected: 1},
+			days:   1,
+			equity: 1,
+			peak:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Load(filepath.Join(t.TempDir(), "pnl.json"), "USDT"); err != nil {
+				t.Fatal(err)
+			}
+			for _, tr := range tt.trades {
+				Record(tr, tickers)
+			}
+			check := func(what string, got, want Stats) {
+				t.Helper()
+				if got.Trades != want.Trades || got.Wins != want.Wins || !equal(got.PnL, want.PnL) ||
+					!equal(got.Fees, want.Fees) || !equal(got.Expected, want.Expected) || !equal(got.Slippage, want.Slippage) {
+					t.Errorf("%s %+v, want %+v", what, got, want)
+				}
+			}
+			check("total", Total(), tt.total)
+			check("today", Today(), tt.today)
+			if len(L.Days) != tt.days {
+				t.Errorf("%d days, want %d", len(L.Days), tt.days)
+			}
+			if !equal(L.Equity, tt.equity) || !equal(L.Peak, tt.peak) || !equal(L.MaxDrawdown, tt.dd) {
+				t.Errorf("equity %f peak %f drawdown %f, want %f %f %f", L.Equity, L.Peak, L.MaxDrawdown, tt.equity, tt.peak, tt.dd)
+			}
+		})
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pnl.json")
+	if err := Load(file, "USDT"); err != nil {
+		t.Fatal(err)
+	}
+	Record(Trade{Time: time.Now(), Route: "A", Asset: "USDT", Initial: 100, Final: 101, Expected: 1}, tickers)
+	Strand("BTC", 0.1)
+	if err := Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the currency of the file wins
+	if err := Load(file, "BTC"); err != nil {
+		t.Fatal(err)
+	}
+	if L.Currency != "USDT" || Total().Trades != 1 || Today().Trades != 1 || L.Stranded["BTC"] != 0.1 {
+		t.Errorf("loaded %+v", L)
+	}
+}
+
+func TestStranded(t *testing.T) {
+	tests := []struct {
+		name    string
+		strand  map[string]float64
+		clear   []string
+		cleared map[string]float64
+		left    float64 // value of the stranded assets left
+	}{
+		{
+			name:    "clear all",
+			strand:  map[string]float64{"BTC": 0.1, "BNB": 1},
+			cleared: map[string]float64{"BTC": 0.1, "BNB": 1},
+		},
+		{
+			name:    "clear one",
+			strand:  map[string]float64{"BTC": 0.1, "BNB": 1},
+			clear:   []string{"BNB"},
+			cleared: map[string]float64{"BNB": 1},
+			left:    2000,
+		},
+		{
+			name:    "clear missing",
+			strand:  map[string]float64{"BTC": 0.1},
+			clear:   []string{"ETH"},
+			cleared: map[string]float64{},
+			left:    2000,
+		},
+		{
+			name:    "nothing stranded",
+			cleared: map[string]float64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Load(filepath.Join(t.TempDir(), "pnl.json"), "USDT"); err != nil {
+				t.Fatal(err)
+			}
+			var value float64
+			for asset, amount := range tt.strand {
+				// stranded twice adds up
+				Strand(asset, amount/2)
+				Strand(asset, amount/2)
+				value += Value(tickers, asset, "USDT", amount)
+			}
+			if got := StrandedValue(tickers); !equal(got, value) {
+				t.Errorf("stranded value %f, want %f", got, value)
+			}
+
+			cleared := ClearStranded(tt.clear...)
+			if len(cleared) != len(tt.cleared) {
+				t.Errorf("cleared %v, want %v", cleared, tt.cleared)
+			}
+			for asset, amount := range tt.cleared {
+				if !equal(cleared[asset], amount) {
+					t.Errorf("cleared %v, want %v", cleared, tt.cleared)
+				}
+			}
+			if got := StrandedValue(tickers); !equal(got, tt.left) {
+				t.Errorf("stranded value %f after clear, want %f", got, tt.left)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/slicken/arbitrager/currencie"
+	"github.com/slicken/arbitrager/journal"
+	"github.com/slicken/arbitrager/logger"
+	"github.com/slicken/arbitrager/orderbook"
+	"github.com/slicken/arbitrager/slippage"
+)
+
+// replayFlags are flags of the replay and backtest commands
+type replayFlags struct {
+	file     string
+	from, to time.Time
+	// size is the amount of asset to trade, 0 uses the journaled amount
+	size     float64
+	cooldown time.Duration
+}
+
+// parseReplayFlags parses flags shared by replay and backtest into the app arguments
+func parseReplayFlags(name string, args []string) replayFlags {
+	var f replayFlags
+	var from, to string
+	fs := newFlagSet(name)
+	fs.StringVar(&f.file, "f", journalFile, "journal file")
+	fs.StringVar(&from, "from", "", "from date (YYYYMMDD)")
+	fs.StringVar(&to, "to", "", "to date (YYYYMMDD), exclusive")
+	fs.Float64Var(&target, "target", target, "minimum target in percentage to trade")
+	fs.Float64Var(&f.size, "size", 0, "amount of asset to trade (0=journaled amount)")
+	fs.IntVar(&steps, "decrease", steps, "also look for arbitrages with a decreasing size N times")
+	fs.DurationVar(&f.cooldown, "cooldown", 5*time.Minute, "pause after a trade")
+	fs.alias("t", "target")
+	fs.alias("s", "size")
+	fs.alias("n", "decrease")
+
+	// config Flags and ARBITRAGER_* variables are meant for the trading commands,
+	// their size is not an asset amount. only args apply here
+	var errs []string
+	if err := fs.Parse(args); err != nil {
+		errs = append(errs, err.Error())
+	}
+	var err error
+	if from != "" {
+		if f.from, err = time.ParseInLocation("20060102", from, time.Local); err != nil {
+			errs = append(errs, "invalid -from: "+err.Error())
+		}
+	}
+	if to != "" {
+		if f.to, err = time.ParseInLocation("20060102", to, time.Local); err != nil {
+			errs = append(errs, "invalid -to: "+err.Error())
+		}
+	}
+	if target <= 0 {
+		errs = append(errs, fmt.Sprintf("--target %v must be above 0", target))
+	}
+	if f.size < 0 {
+		errs = append(errs, fmt.Sprintf("--size %v must not be negative", f.size))
+	}
+	if steps < 1 {
+		errs = append(errs, fmt.Sprintf("--decrease %d must be at least 1", steps))
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "%s:\n  %s\n", name, strings.Join(errs, "\n  "))
+		os.Exit(2)
+	}
+	return f
+}
+
+// opportunities returns journaled opportunities with their books
+func (f replayFlags) opportunities() []journal.Entry {
+	list, err := journal.Read(f.file, f.from, f.to)
+	if err != nil {
+		fmt.Println("could not read journal:", err)
+		os.Exit(1)
+	}
+	var opps []journal.Entry
+	for _, e := range list {
+		if e.Type == journal.Opportunity && len(e.Pairs) == 3 && len(e.Sides) == 3 && len(e.Books) == 3 {
+			opps = append(opps, e)
+		}
+	}
+	// margins come from current slippage estimates
+	if err := slippage.Load(slippageFile); err != nil {
+		fmt.Println("could not load slippage:", err)
+	}
+	// calcStepProfits logs what it finds
+	logger.SetOutput(ioutil.Discard)
+	return opps
+}
+
+// setFromEntry rebuilds the set of a journaled opportunity.
+// the base and quote of each pair follow from the assets spent along the route
+func setFromEntry(e journal.Entry) (Set, error) {
+	s := Set{asset: e.Asset}
+	spent := e.Asset
+	for i, name := range e.Pairs {
+		p := currencie.Pair{Name: name, Enabled: true}
+		switch e.Sides[i] {
+		case Side[buy]:
+			if !strings.HasSuffix(name, spent) {
+				return s, fmt.Errorf("%s does not buy with %s", name, spent)
+			}
+			p.Quote = spent
+			p.Base = strings.TrimSuffix(name, spent)
+			spent = p.Base
+			s.route[i] = buy
+		case Side[sell]:
+			if !strings.HasPrefix(name, spent) {
+				return s, fmt.Errorf("%s does not sell %s", name, spent)
+			}
+			p.Base = spent
+			p.Quote = strings.TrimPrefix(name, spent)
+			spent = p.Quote
+			s.route[i] = sell
+		default:
+			return s, fmt.Errorf("unknown side %q", e.Sides[i])
+		}
+		s.pair[i] = p
+	}
+	return s, nil
+}
+
+// loadBooks replaces local books with snapshots
+func loadBooks(snaps []orderbook.Snapshot) {
+	for _, snap := range snaps {
+		book, _ := orderbook.GetBook(snap.Name)
+		book.Reset()
+		for _, v := range snap.Bids {
+			book.Add(v.Price, v.Amount, true)
+		}
+		for _, v := range snap.Asks {
+			book.Add(v.Price, v.Amount, false)
+		}
+	}
+}
+
+// runReplay re-evaluates journaled opportunities with other settings
+func runReplay(args []string) {
+	f := parseReplayFlags("replay", args)
+	opps := f.opportunities()
+
+	var trade, skip int
+	for _, e := range opps {
+		s, err := setFromEntry(e)
+		if err != nil {
+			fmt.Printf("%s  %-8s %v\n", e.Time.Format("2006-01-02 15:04:05"), "error", err)
+			continue
+		}
+		loadBooks(e.Books)
+		amount := f.size
+		if amount == 0 {
+			amount = e.Initial
+		}
+
+		result := "skip"
+		perc := "-"
+		if o := s.calcStepProfits(amount); o != nil {
+			result = "trade"
+			perc = fmt.Sprintf("%.2f%%", o.perc)
+			trade++
+		} else {
+			skip++
+		}
+		fmt.Printf("%s  %-8s %7.2f%% -> %-7s %s\n", e.Time.Format("2006-01-02 15:04:05"), result, e.Perc, perc, s.Name())
+	}
+	fmt.Printf("\n%d opportunities, %d would trade, %d would skip at target %.2f%%\n", len(opps), trade, skip, target)
+}
+
+// runBacktest simulates trading journaled opportunities from their books.
+// books are journaled a few levels deep, so large sizes fail as too thin
+func runBacktest(args []string) {
+	f := parseReplayFlags("backtest", args)
+	opps := f.opportunities()
+
+	type result struct {
+		trades, wins, failed int
+		pnl, expected        float64
+	}
+	results := make(map[string]*result)
+	var next time.Time
+	for _, e := range opps {
+		if e.Time.Before(next) {
+			continue
+		}
+		s, err := setFromEntry(e)
+		if err != nil {
+			continue
+		}
+		loadBooks(e.Books)
+		amount := f.size
+		if amount == 0 {
+			amount = e.Initial
+		}
+		o := s.calcStepProfits(amount)
+		if o == nil {
+			continue
+		}
+		r, ok := results[o.asset]
+		if !ok {
+			r = new(result)
+			results[o.asset] = r
+		}
+
+		qty := o.initial
+		for i, side := range o.route {
+			req := journal.OrderRequest{Pair: o.pair[i].Name, Side: Side[side]}
+			if side == buy {
+				req.Quote = qty
+			} else {
+				req.Amount = qty
+			}
+			t, err := fillFromBook(o.pair[i], req)
+			if err != nil {
+				qty = 0
+				break
+			}
+			qty = t.Received
+		}
+		if qty == 0 {
+			r.failed++
+			fmt.Printf("%s  %-8s %s\n", e.Time.Format("2006-01-02 15:04:05"), "failed", o.Name())
+			continue
+		}
+		r.trades++
+		if qty > o.initial {
+			r.wins++
+		}
+		r.pnl += qty - o.initial
+		r.expected += o.profit
+		next = e.Time.Add(f.cooldown)
+		fmt.Printf("%s  %-8s %f (%5.2f%%) expected %f  %s\n", e.Time.Format("2006-01-02 15:04:05"), "trade",
+			qty-o.initial, (qty/o.initial)*100-100, o.profit, o.Name())
+	}
+
+	fmt.Printf("\n%d opportunities at target %.2f%%\n", len(opps), target)
+	fmt.Printf("%-8s %7s %7s %7s %16s %16s\n", "asset", "trades", "wins", "failed", "pnl", "expected")
+	var keys []string
+	for asset := range results {
+		keys = append(keys, asset)
+	}
+	sort.Strings(keys)
+	for _, asset := range keys {
+		r := results[asset]
+		fmt.Printf("%-8s %7d %7d %7d %16f %16f\n", asset, r.trades, r.wins, r.failed, r.pnl, r.expected)
+	}
+}
@@ -0,0 +1,183 @@
+package risk
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/slicken/arbitrager/config"
+	"github.com/slicken/arbitrager/logger"
+)
+
+var riskLog = logger.New("risk")
+
+// Trip is returned when a limit stops a route
+type Trip struct {
+	Limit  string
+	Reason string
+	// Halt is true if trading stays halted until resumed
+	Halt bool
+}
+
+func (t *Trip) Error() string {
+	return t.Limit + ": " + t.Reason
+}
+
+var (
+	mu     sync.Mutex
+	limits config.RiskConfig
+	halted string
+	losses int
+	// last trip of each limit, to log and alert them once
+	tripped = make(map[string]string)
+
+	// OnTrip is called when a limit trips or trading is halted
+	OnTrip func(t *Trip)
+)
+
+// SetLimits sets the limits checked before each route
+func SetLimits(l config.RiskConfig) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	limits = l
+}
+
+// Limits returns the current limits
+func Limits() config.RiskConfig {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return limits
+}
+
+// Halt stops trading until Resume. scanning goes on
+func Halt(reason string) {
+	mu.Lock()
+	was := halted
+	halted = reason
+	mu.Unlock()
+
+	if was == "" {
+		trip(&Trip{Limit: "halt", Reason: reason, Halt: true})
+	}
+}
+
+// Resume trading after a Halt and reset consecutive losses
+func Resume() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if halted != "" {
+		riskLog.Info("trading resumed")
+	}
+	halted = ""
+	losses = 0
+	tripped = make(map[string]string)
+}
+
+// Halted returns the halt reason, if halted
+func Halted() (string, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if halted == "" && killed() {
+		return killReason(), true
+	}
+	return halted, halted != ""
+}
+
+// killed returns true if the kill file exists. must be called with mu locked
+func killed() bool {
+	if limits.KillFile == "" {
+		return false
+	}
+	_, err := os.Stat(limits.KillFile)
+	return err == nil
+}
+
+// killReason returns the halt reason of the kill file. must be called with mu locked
+func killReason() string {
+	return "kill file " + limits.KillFile + " exists"
+}
+
+// Losses returns number of consecutive losing routes
+func Losses() int {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return losses
+}
+
+// Result records the realized pnl of a route
+func Result(pnl float64) {
+	mu.Lock()
+	if pnl < 0 {
+		losses++
+	} else {
+		losses = 0
+	}
+	n, max := losses, limits.MaxConsecutiveLosses
+	mu.Unlock()
+
+	if max > 0 && n >= max {
+		Halt(fmt.Sprintf("%d consecutive losing routes", n))
+	}
+}
+
+// Check returns a *Trip if a route of notional USD may not be traded.
+// daily is todays realized pnl and stranded the value of stranded assets, both in USD
+func Check(notional, daily, stranded float64) error {
+	mu.Lock()
+	reason := halted
+	// the kill file halts without Halt, log and alert it the first time it is seen
+	var first bool
+	if reason == "" && killed() {
+		reason = killReason()
+		first = tripped["kill file"] == ""
+		tripped["kill file"] = reason
+	} else {
+		delete(tripped, "kill file")
+	}
+	mu.Unlock()
+	if reason != "" {
+		t := &Trip{Limit: "halt", Reason: reason, Halt: true}
+		if first {
+			trip(t)
+		}
+		return t
+	}
+
+	l := Limits()
+	var t *Trip
+	switch {
+	case l.MaxDailyLoss > 0 && -daily >= l.MaxDailyLoss:
+		t = &Trip{Limit: "daily loss", Reason: fmt.Sprintf("lost %.2f USD today, max %.2f", -daily, l.MaxDailyLoss)}
+	case l.MaxStranded > 0 && stranded >= l.MaxStranded:
+		t = &Trip{Limit: "stranded", Reason: fmt.Sprintf("%.2f USD stranded, max %.2f", stranded, l.MaxStranded)}
+	case l.MaxNotional > 0 && notional > l.MaxNotional:
+		t = &Trip{Limit: "notional", Reason: fmt.Sprintf("route of %.2f USD, max %.2f", notional, l.MaxNotional)}
+	}
+	if t == nil {
+		return nil
+	}
+
+	// log and alert each limit once a day
+	key := time.Now().Format("20060102")
+	mu.Lock()
+	seen := tripped[t.Limit] == key
+	tripped[t.Limit] = key
+	mu.Unlock()
+	if !seen {
+		trip(t)
+	}
+	return t
+}
+
+func trip(t *Trip) {
+	riskLog.Warn("tripped", "limit", t.Limit, "reason", t.Reason, "halt", t.Halt)
+	if OnTrip != nil {
+		OnTrip(t)
+	}
+}
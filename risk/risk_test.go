@@ -0,0 +1,151 @@
+package risk
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/slicken/arbitrager/config"
+)
+
+// reset clears halts and losses, sets limits l and returns the trips alerted
+func reset(l config.RiskConfig) *[]*Trip {
+	Resume()
+	SetLimits(l)
+	var trips []*Trip
+	OnTrip = func(t *Trip) { trips = append(trips, t) }
+	return &trips
+}
+
+// limit returns the limit of the trip of err, if any
+func limit(err error) string {
+	var t *Trip
+	if errors.As(err, &t) {
+		return t.Limit
+	}
+	return ""
+}
+
+func TestCheck(t *testing.T) {
+	limits := config.RiskConfig{MaxNotional: 100, MaxDailyLoss: 50, MaxStranded: 20}
+	tests := []struct {
+		name     string
+		limits   config.RiskConfig
+		notional float64
+		daily    float64
+		stranded float64
+		want     string
+	}{
+		{name: "no limits", notional: 1e6, daily: -1e6, stranded: 1e6},
+		{name: "within limits", limits: limits, notional: 100, daily: -49, stranded: 19},
+		{name: "daily profit", limits: limits, notional: 10, daily: 1000},
+		{name: "notional", limits: limits, notional: 101, want: "notional"},
+		{name: "daily loss", limits: limits, notional: 10, daily: -50, want: "daily loss"},
+		{name: "stranded", limits: limits, notional: 10, stranded: 20, want: "stranded"},
+		{name: "daily loss first", limits: limits, notional: 101, daily: -60, stranded: 30, want: "daily loss"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trips := reset(tt.limits)
+			err := Check(tt.notional, tt.daily, tt.stranded)
+			if got := limit(err); got != tt.want {
+				t.Fatalf("Check = %v, want limit %q", err, tt.want)
+			}
+			if err == nil {
+				return
+			}
+			if _, halted := Halted(); halted {
+				t.Errorf("halted by %s, limits only stop the route", tt.want)
+			}
+			// alerted once a day
+			Check(tt.notional, tt.daily, tt.stranded)
+			if len(*trips) != 1 {
+				t.Errorf("%d trips alerted, want 1", len(*trips))
+			}
+		})
+	}
+}
+
+func TestConsecutiveLosses(t *testing.T) {
+	tests := []struct {
+		name    string
+		max     int
+		results []float64
+		losses  int
+		halted  bool
+	}{
+		{name: "no limit", results: []float64{-1, -1, -1, -1}, losses: 4},
+		{name: "below max", max: 3, results: []float64{-1, -1}, losses: 2},
+		{name: "max reached", max: 3, results: []float64{-1, -1, -1}, losses: 3, halted: true},
+		{name: "win resets", max: 3, results: []float64{-1, -1, 1, -1, -1}, losses: 2},
+		{name: "break even resets", max: 2, results: []float64{-1, 0, -1}, losses: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trips := reset(config.RiskConfig{MaxConsecutiveLosses: tt.max})
+			for _, pnl := range tt.results {
+				Result(pnl)
+			}
+			if got := Losses(); got != tt.losses {
+				t.Errorf("%d losses, want %d", got, tt.losses)
+			}
+			_, halted := Halted()
+			if halted != tt.halted {
+				t.Fatalf("halted %v, want %v", halted, tt.halted)
+			}
+			err := Check(0, 0, 0)
+			if !tt.halted {
+				if err != nil {
+					t.Errorf("Check = %v, want nil", err)
+				}
+				return
+			}
+			if tr, ok := err.(*Trip); !ok || !tr.Halt {
+				t.Errorf("Check = %v, want a halt", err)
+			}
+			if len(*trips) != 1 {
+				t.Errorf("%d trips alerted, want 1", len(*trips))
+			}
+
+			Resume()
+			if _, halted := Halted(); halted || Losses() != 0 || Check(0, 0, 0) != nil {
+				t.Errorf("still halted after resume, %d losses", Losses())
+			}
+		})
+	}
+}
+
+func TestKillFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "kill")
+	trips := reset(config.RiskConfig{KillFile: file})
+
+	if err := Check(0, 0, 0); err != nil {
+		t.Fatalf("Check = %v without kill file", err)
+	}
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if tr, ok := Check(0, 0, 0).(*Trip); !ok || !tr.Halt {
+			t.Fatalf("Check = %v with kill file, want a halt", tr)
+		}
+	}
+	if _, halted := Halted(); !halted {
+		t.Error("not halted with kill file")
+	}
+	if len(*trips) != 1 {
+		t.Errorf("%d trips alerted, want 1", len(*trips))
+	}
+
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(0, 0, 0); err != nil {
+		t.Errorf("Check = %v after kill file removed", err)
+	}
+	if _, halted := Halted(); halted {
+		t.Error("halted after kill file removed")
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// allSets returns every set in SetsMap once, sorted by name
+func allSets() []Set {
+	seen := make(map[string]bool)
+	var list []Set
+	for _, sets := range SetsMap {
+		for _, s := range sets {
+			if seen[s.Name()] {
+				continue
+			}
+			seen[s.Name()] = true
+			list = append(list, s)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+	return list
+}
+
+// pairVolume returns the 24h quote volume of pair in USD, 0 if unknown
+func pairVolume(volumes map[string]float64, pair string) float64 {
+	p, err := E.Pair(pair)
+	if err != nil {
+		return 0
+	}
+	return usdValue(p.Quote, volumes[pair])
+}
+
+// volume returns the 24h volume in USD of the least traded pair of s
+func (s Set) volume(volumes map[string]float64) float64 {
+	min := -1.0
+	for _, p := range s.pair {
+		if v := pairVolume(volumes, p.Name); min < 0 || v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// routeLeg describes one leg of a route
+type routeLeg struct {
+	Pair      string  `json:"pair"`
+	Side      string  `json:"side"`
+	Base      string  `json:"base"`
+	Quote     string  `json:"quote"`
+	TickSize  float64 `json:"tick_size"`
+	StepSize  float64 `json:"step_size"`
+	VolumeUSD float64 `json:"volume_usd"`
+}
+
+// routeInfo describes a route and if it is streamed
+type routeInfo struct {
+	Name  string     `json:"name"`
+	Shape string     `json:"shape"`
+	Asset string     `json:"asset"`
+	Legs  []routeLeg `json:"legs"`
+	// VolumeUSD is the 24h volume of the least traded leg
+	VolumeUSD float64 `json:"volume_usd"`
+	// Cut is true if the route is left out under limit
+	Cut bool `json:"cut"`
+	// Top is true if the route is one of the top most traded
+	Top bool `json:"top"`
+}
+
+// routesReport is the output of the routes command
+type routesReport struct {
+	Assets []string    `json:"assets"`
+	Limit  int         `json:"limit"`
+	Routes []routeInfo `json:"routes"`
+	// Books are all books the routes need, Subscribed those kept under limit
+	Books      int `json:"books"`
+	Subscribed int `json:"subscribed"`
+	Cut        int `json:"cut"`
+	// TopBooks are the books needed by the top most traded routes
+	Top      int      `json:"top"`
+	TopBooks []string `json:"top_books"`
+}
+
+// runRoutes lists the triangles built for assets
+func runRoutes(args []string) {
+	var format string
+	var top int
+	fs := newFlagSet("routes")
+	fs.Var((*listValue)(&assets), "asset", "assets to arbitrage, separated by ','")
+	fs.BoolVar(&all, "all", all, "all assets with a balance")
+	fs.Var((*listValue)(&except), "except", "except these assets")
+	fs.IntVar(&limit, "limit", limit, "limit maximum connections to orderbooks")
+	fs.StringVar(&priority, "priority", priority, "keep routes by 'volume' or 'episodes' under limit")
+	fs.IntVar(&top, "top", 10, "list books needed by the top N most traded routes")
+	fs.StringVar(&format, "format", "text", "output format: text, json or csv")
+	fs.alias("a", "asset")
+	fs.alias("e", "except")
+	fs.alias("l", "limit")
+	var errs []string
+	if err := fs.parse(args); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if !all && len(assets) == 0 {
+		errs = append(errs, "--asset or --all is required")
+	}
+	if limit < 3 {
+		errs = append(errs, fmt.Sprintf("--limit %d must be at least 3, the books of one triangle", limit))
+	}
+	if priority != "volume" && priority != "episodes" {
+		errs = append(errs, fmt.Sprintf("--priority %q must be volume or episodes", priority))
+	}
+	if top < 0 {
+		errs = append(errs, fmt.Sprintf("--top %d must not be negative", top))
+	}
+	switch format {
+	case "text", "json", "csv":
+	default:
+		errs = append(errs, fmt.Sprintf("--format %q must be text, json or csv", format))
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "routes:\n  %s\n", strings.Join(errs, "\n  "))
+		os.Exit(2)
+	}
+
+	connect()
+	var err error
+	if tickers, err = E.GetAllTickers(); err != nil {
+		fmt.Println("could not get tickers:", err)
+		os.Exit(1)
+	}
+	volumes, err := E.GetVolumes()
+	if err != nil {
+		fmt.Println("could not get volumes:", err)
+		os.Exit(1)
+	}
+	if err := selectAssets(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	mapSets()
+
+	r := routesReport{Assets: assets, Limit: limit, Top: top}
+	// selectPairs drops sets it leaves out from SetsMap
+	sets := allSets()
+	r.Books = len(SetMapList())
+	subscribed := make(map[string]bool)
+	for _, p := range selectPairs() {
+		subscribed[p] = true
+	}
+	r.Subscribed = len(subscribed)
+	kept := make(map[string]bool)
+	for _, s := range allSets() {
+		kept[s.Name()] = true
+	}
+
+	for _, s := range sets {
+		info := routeInfo{
+			Name:      s.Name(),
+			Shape:     s.route.String(),
+			Asset:     s.asset,
+			VolumeUSD: s.volume(volumes),
+		}
+		for i, p := range s.pair {
+			info.Legs = append(info.Legs, routeLeg{
+				Pair:      p.Name,
+				Side:      Side[s.route[i]],
+				Base:      p.Base,
+				Quote:     p.Quote,
+				TickSize:  p.FilterPrice,
+				StepSize:  p.FilterSize,
+				VolumeUSD: pairVolume(volumes, p.Name),
+			})
+		}
+		info.Cut = !kept[s.Name()]
+		if info.Cut {
+			r.Cut++
+		}
+		r.Routes = append(r.Routes, info)
+	}
+
+	// the books of the top routes are the smallest set that covers them
+	byVolume := make([]int, len(r.Routes))
+	for i := range byVolume {
+		byVolume[i] = i
+	}
+	sort.SliceStable(byVolume, func(i, j int) bool {
+		return r.Routes[byVolume[i]].VolumeUSD > r.Routes[byVolume[j]].VolumeUSD
+	})
+	books := make(map[string]bool)
+	for n, i := range byVolume {
+		if n >= top {
+			break
+		}
+		r.Routes[i].Top = true
+		for _, l := range r.Routes[i].Legs {
+			if !books[l.Pair] {
+				books[l.Pair] = true
+				r.TopBooks = append(r.TopBooks, l.Pair)
+			}
+		}
+	}
+	sort.Strings(r.TopBooks)
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(r); err != nil {
+			fmt.Println("could not write json:", err)
+			os.Exit(1)
+		}
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		header := []string{"name", "shape", "asset"}
+		for i := 1; i <= 3; i++ {
+			n := strconv.Itoa(i)
+			header = append(header, "side"+n, "pair"+n, "tick_size"+n, "step_size"+n, "volume_usd"+n)
+		}
+		w.Write(append(header, "volume_usd", "cut", "top"))
+		for _, info := range r.Routes {
+			row := []string{info.Name, info.Shape, info.Asset}
+			for _, l := range info.Legs {
+				row = append(row, l.Side, l.Pair, formatFloat(l.TickSize), formatFloat(l.StepSize), formatFloat(l.VolumeUSD))
+			}
+			w.Write(append(row, formatFloat(info.VolumeUSD), strconv.FormatBool(info.Cut), strconv.FormatBool(info.Top)))
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			fmt.Println("could not write csv:", err)
+			os.Exit(1)
+		}
+	default:
+		for _, info := range r.Routes {
+			mark := ""
+			if info.Cut {
+				mark = "cut"
+			}
+			fmt.Printf("%-4s %-4s %14.0f USD  %s\n", info.Shape, mark, info.VolumeUSD, info.Name)
+			for _, l := range info.Legs {
+				fmt.Printf("       %-4s %-12s tick %-12g step %-12g %14.0f USD\n", l.Side, l.Pair, l.TickSize, l.StepSize, l.VolumeUSD)
+			}
+		}
+		fmt.Printf("\n%d routes on %d books, %d books subscribed under limit %d, %d routes cut\n",
+			len(r.Routes), r.Books, r.Subscribed, r.Limit, r.Cut)
+		if top > 0 {
+			fmt.Printf("top %d routes by volume need %d books: %s\n", top, len(r.TopBooks), strings.Join(r.TopBooks, " "))
+		}
+	}
+}
+
+// formatFloat formats f without trailing zeros
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
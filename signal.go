@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/slicken/arbitrager/risk"
+)
+
+// HandleKillSignals halts trading on SIGUSR1 and resumes on SIGUSR2
+func HandleKillSignals() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		for sig := range c {
+			switch sig {
+			case syscall.SIGUSR1:
+				risk.Halt("halted by signal")
+			case syscall.SIGUSR2:
+				risk.Resume()
+			}
+			log.Println("received", sig)
+		}
+	}()
+}
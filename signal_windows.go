@@ -0,0 +1,4 @@
+package main
+
+// HandleKillSignals does nothing on windows, use the kill file
+func HandleKillSignals() {}
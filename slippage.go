@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/slicken/arbitrager/orders"
+	"github.com/slicken/arbitrager/slippage"
+)
+
+const slippageFile = "slippage.json"
+
+// String returns the shape of the route, eg. "bbs"
+func (r Route) String() string {
+	var b []byte
+	for _, s := range r {
+		b = append(b, Side[s][0])
+	}
+	return string(b)
+}
+
+// margin returns estimated slippage in percent of the set
+func (s Set) margin() float64 {
+	return slippage.Margin(s.route.String(), s.pair[0].Name, s.pair[1].Name, s.pair[2].Name)
+}
+
+// recordSlippage adds executed prices of trades compared to the estimated prices of o
+func (o *OrderSet) recordSlippage(trades [3]*orders.Trade) {
+	var total float64
+	for i, t := range trades {
+		if t == nil {
+			return
+		}
+		total += slippage.Leg(o.pair[i].Name, o.route[i] == buy, o.price[i], t.Price)
+	}
+	slippage.Route(o.route.String(), total)
+	if err := slippage.Save(); err != nil {
+		log.Println("could not save slippage:", err.Error())
+	}
+}
+
+// runSlippage prints slippage estimates
+func runSlippage(args []string) {
+	fs := flag.NewFlagSet("slippage", flag.ExitOnError)
+	file := fs.String("f", slippageFile, "slippage file")
+	fs.Parse(args)
+
+	if err := slippage.Load(*file); err != nil {
+		fmt.Println("could not load slippage:", err)
+		os.Exit(1)
+	}
+	slippage.Report(os.Stdout)
+}
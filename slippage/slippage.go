@@ -0,0 +1,153 @@
+package slippage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/slicken/arbitrager/config"
+)
+
+// Alpha is the weight of the newest sample in the rolling estimate
+var Alpha = 0.2
+
+// Estimate is a rolling slippage estimate in percent.
+// positive means we got a worse price than estimated
+type Estimate struct {
+	Mean  float64
+	Last  float64
+	Worst float64
+	Count int
+}
+
+func (e *Estimate) add(v float64) {
+	if e.Count == 0 {
+		e.Mean = v
+	} else {
+		e.Mean = Alpha*v + (1-Alpha)*e.Mean
+	}
+	e.Last = v
+	if v > e.Worst {
+		e.Worst = v
+	}
+	e.Count++
+}
+
+// Estimates holds estimates per pair and per route shape
+type Estimates struct {
+	Pairs  map[string]*Estimate
+	Shapes map[string]*Estimate
+}
+
+var (
+	mu       sync.Mutex
+	filename string
+	est      = Estimates{
+		Pairs:  make(map[string]*Estimate),
+		Shapes: make(map[string]*Estimate),
+	}
+)
+
+// Load reads estimates from file, if it exists
+func Load(file string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	filename = file
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil
+	}
+	return config.ReadFile(&est, file)
+}
+
+// Save writes estimates to file
+func Save() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if filename == "" {
+		return nil
+	}
+	return config.WriteFile(est, filename)
+}
+
+// Leg adds the slippage of a leg on pair and returns it in percent
+func Leg(pair string, buy bool, expected, executed float64) float64 {
+	if expected == 0 || executed == 0 {
+		return 0
+	}
+	v := (executed - expected) / expected * 100
+	if !buy {
+		v = -v
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	get(est.Pairs, pair).add(v)
+	return v
+}
+
+// Route adds the total slippage in percent of a route shape
+func Route(shape string, v float64) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	get(est.Shapes, shape).add(v)
+}
+
+// Margin returns the safety margin in percent to add on top of
+// the target for a route of shape over pairs
+func Margin(shape string, pairs ...string) float64 {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var sum float64
+	for _, p := range pairs {
+		if e, ok := est.Pairs[p]; ok {
+			sum += e.Mean
+		}
+	}
+	if e, ok := est.Shapes[shape]; ok && e.Mean > sum {
+		sum = e.Mean
+	}
+	if sum < 0 {
+		return 0
+	}
+	return sum
+}
+
+// Report writes estimates to w, worst first
+func Report(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	table := func(title string, m map[string]*Estimate) {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return m[keys[i]].Mean > m[keys[j]].Mean
+		})
+		fmt.Fprintf(w, "%-16s %7s %9s %9s %9s\n", title, "count", "mean%", "last%", "worst%")
+		for _, k := range keys {
+			e := m[k]
+			fmt.Fprintf(w, "%-16s %7d %9.3f %9.3f %9.3f\n", k, e.Count, e.Mean, e.Last, e.Worst)
+		}
+	}
+	table("route", est.Shapes)
+	fmt.Fprintln(w)
+	table("pair", est.Pairs)
+}
+
+func get(m map[string]*Estimate, key string) *Estimate {
+	e, ok := m[key]
+	if !ok {
+		e = new(Estimate)
+		m[key] = e
+	}
+	return e
+}
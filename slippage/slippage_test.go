@@ -0,0 +1,155 @@
+package slippage
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// reset drops all estimates
+func reset() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	est = Estimates{
+		Pairs:  make(map[string]*Estimate),
+		Shapes: make(map[string]*Estimate),
+	}
+}
+
+// equal compares floats within rounding errors
+func equal(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestLeg(t *testing.T) {
+	tests := []struct {
+		name     string
+		buy      bool
+		expected float64
+		executed float64
+		want     float64
+	}{
+		{"buy higher", true, 100, 101, 1},
+		{"buy lower", true, 100, 99, -1},
+		{"sell lower", false, 100, 99, 1},
+		{"sell higher", false, 100, 101, -1},
+		{"no expected price", true, 0, 101, 0},
+		{"not executed", true, 100, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset()
+			if got := Leg("BTCUSDT", tt.buy, tt.expected, tt.executed); !equal(got, tt.want) {
+				t.Errorf("Leg(%v, %f, %f) = %f, want %f", tt.buy, tt.expected, tt.executed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMargin(t *testing.T) {
+	type leg struct {
+		pair     string
+		buy      bool
+		expected float64
+		executed float64
+	}
+	tests := []struct {
+		name   string
+		legs   []leg
+		routes []float64 // slippage of the shape
+		pairs  []string
+		want   float64
+	}{
+		{
+			name:  "no estimates",
+			pairs: []string{"A", "B", "C"},
+		},
+		{
+			name:  "one pair",
+			legs:  []leg{{"A", true, 100, 101}},
+			pairs: []string{"A", "B", "C"},
+			want:  1,
+		},
+		{
+			name:  "rolling mean",
+			legs:  []leg{{"A", true, 100, 101}, {"A", true, 100, 102}, {"A", true, 100, 100}},
+			pairs: []string{"A"},
+			// 1, then 0.2*2 + 0.8*1, then 0.2*0 + 0.8*1.2
+			want: 0.96,
+		},
+		{
+			name:  "sum of pairs",
+			legs:  []leg{{"A", true, 100, 101}, {"B", false, 100, 99.5}},
+			pairs: []string{"A", "B", "C"},
+			want:  1.5,
+		},
+		{
+			name:  "other pairs ignored",
+			legs:  []leg{{"A", true, 100, 101}, {"D", true, 100, 105}},
+			pairs: []string{"A", "B", "C"},
+			want:  1,
+		},
+		{
+			name:   "route above pairs",
+			legs:   []leg{{"A", true, 100, 101}},
+			routes: []float64{2},
+			pairs:  []string{"A", "B", "C"},
+			want:   2,
+		},
+		{
+			name:   "route below pairs",
+			legs:   []leg{{"A", true, 100, 101}, {"B", true, 100, 100.5}},
+			routes: []float64{1},
+			pairs:  []string{"A", "B", "C"},
+			want:   1.5,
+		},
+		{
+			name:   "price improvement",
+			legs:   []leg{{"A", true, 100, 99}},
+			routes: []float64{-1},
+			pairs:  []string{"A", "B", "C"},
+			want:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset()
+			for _, l := range tt.legs {
+				Leg(l.pair, l.buy, l.expected, l.executed)
+			}
+			for _, v := range tt.routes {
+				Route("buy buy sell", v)
+			}
+			if got := Margin("buy buy sell", tt.pairs...); !equal(got, tt.want) {
+				t.Errorf("Margin = %f, want %f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	reset()
+	file := filepath.Join(t.TempDir(), "slippage.json")
+	if err := Load(file); err != nil {
+		t.Fatal(err)
+	}
+	Leg("A", true, 100, 101)
+	Leg("A", true, 100, 103)
+	Route("buy buy sell", 2)
+	if err := Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reset()
+	if err := Load(file); err != nil {
+		t.Fatal(err)
+	}
+	a := est.Pairs["A"]
+	if a == nil || a.Count != 2 || !equal(a.Mean, 1.4) || !equal(a.Last, 3) || !equal(a.Worst, 3) {
+		t.Errorf("loaded pair %+v", a)
+	}
+	if got := Margin("buy buy sell", "A"); !equal(got, 2) {
+		t.Errorf("Margin = %f after load, want 2", got)
+	}
+}
@@ -0,0 +1,257 @@
+package utils
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogRotation holds where log files are written and how long they are kept
+type LogRotation struct {
+	// Dir holds the log files, the working directory if empty
+	Dir string
+	// MaxSize in bytes rotates the file before it grows above. files are also rotated daily. 0=no limit
+	MaxSize int64
+	// MaxFiles is the number of compressed files kept. 0=all
+	MaxFiles int
+	// MaxAge removes compressed files older than it. 0=never
+	MaxAge time.Duration
+}
+
+// logWriter appends to the log file of the day and rotates it by size and date.
+// rotated files are compressed and old ones removed in the background
+type logWriter struct {
+	LogRotation
+	tag string
+
+	mu   sync.Mutex
+	f    *os.File
+	path string
+	day  string
+	size int64
+	// cleaning serializes compression and removal of rotated files
+	cleaning sync.Mutex
+}
+
+// openLogWriter opens the log file of today for tag in append mode
+func openLogWriter(tag string, r LogRotation) (*logWriter, error) {
+	if r.Dir != "" {
+		if err := os.MkdirAll(r.Dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	w := &logWriter{LogRotation: r, tag: tag}
+	if err := w.open(time.Now()); err != nil {
+		return nil, err
+	}
+	// files left by earlier runs
+	go w.cleanup()
+	return w, nil
+}
+
+// name returns the file name of day
+func (w *logWriter) name(day string) string {
+	return filepath.Join(w.Dir, w.tag+day+".log")
+}
+
+// open opens the file of the day of t. must be called with mu locked
+func (w *logWriter) open(t time.Time) error {
+	day := t.Format("20060102")
+	f, err := os.OpenFile(w.name(day), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.f, w.path, w.day, w.size = f, f.Name(), day, fi.Size()
+	return nil
+}
+
+// Name returns the path of the current file
+func (w *logWriter) Name() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.path
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return 0, os.ErrClosed
+	}
+	now := time.Now()
+	if now.Format("20060102") != w.day || w.MaxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.MaxSize {
+		if err := w.rotate(now); err != nil {
+			// keep writing to the current file
+			fmt.Fprintf(os.Stderr, "could not rotate log %q: %v\n", w.f.Name(), err)
+		}
+	}
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate moves the current file aside and opens the file of the day of t.
+// must be called with mu locked
+func (w *logWriter) rotate(t time.Time) error {
+	old := w.f.Name()
+	if w.day == t.Format("20060102") {
+		// same day, rotated by size
+		old = w.nextPart(w.day)
+		if err := os.Rename(w.f.Name(), old); err != nil {
+			return err
+		}
+	}
+	prev := w.f
+	if err := w.open(t); err != nil {
+		if old != prev.Name() {
+			// move it back, the file is still open
+			os.Rename(old, prev.Name())
+		}
+		return err
+	}
+	prev.Close()
+	go w.cleanup()
+	return nil
+}
+
+// nextPart returns a free name for a part of day rotated by size
+func (w *logWriter) nextPart(day string) string {
+	for i := 1; ; i++ {
+		name := filepath.Join(w.Dir, fmt.Sprintf("%s%s.%d.log", w.tag, day, i))
+		if _, err := os.Stat(name); err == nil {
+			continue
+		}
+		if _, err := os.Stat(name + ".gz"); err == nil {
+			continue
+		}
+		return name
+	}
+}
+
+// cleanup compresses rotated files and removes old ones
+func (w *logWriter) cleanup() {
+	w.cleaning.Lock()
+	defer w.cleaning.Unlock()
+
+	current := w.Name()
+	logs, _ := filepath.Glob(filepath.Join(w.Dir, w.tag+"*.log"))
+	for _, name := range logs {
+		if name == current || !w.rotated(name) {
+			continue
+		}
+		if err := compress(name); err != nil {
+			fmt.Fprintf(os.Stderr, "could not compress log %q: %v\n", name, err)
+		}
+	}
+
+	if w.MaxFiles <= 0 && w.MaxAge <= 0 {
+		return
+	}
+	gz, _ := filepath.Glob(filepath.Join(w.Dir, w.tag+"*.log.gz"))
+	type file struct {
+		name string
+		mod  time.Time
+	}
+	var files []file
+	for _, name := range gz {
+		if !w.rotated(strings.TrimSuffix(name, ".gz")) {
+			continue
+		}
+		if fi, err := os.Stat(name); err == nil {
+			files = append(files, file{name, fi.ModTime()})
+		}
+	}
+	// newest first
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].mod.After(files[j].mod)
+	})
+	for i, f := range files {
+		if w.MaxFiles > 0 && i >= w.MaxFiles || w.MaxAge > 0 && time.Since(f.mod) > w.MaxAge {
+			os.Remove(f.name)
+		}
+	}
+}
+
+// rotated returns true if name is a log file of tag, <tag><date>[.<part>].log
+func (w *logWriter) rotated(name string) bool {
+	s := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(name), w.tag), ".log")
+	if i := strings.IndexByte(s, '.'); i > 0 {
+		s = s[:i]
+	}
+	_, err := time.Parse("20060102", s)
+	return err == nil
+}
+
+// compress gzips name to name.gz and removes name
+func compress(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	tmp := name + ".gz.tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err = os.Rename(tmp, name+".gz"); err != nil {
+		return err
+	}
+	// keep the time of the last line, retention goes by it
+	os.Chtimes(name+".gz", fi.ModTime(), fi.ModTime())
+	src.Close()
+	return os.Remove(name)
+}
+
+// Sync commits the current file to disk
+func (w *logWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+	return w.f.Sync()
+}
+
+// Close closes the current file
+func (w *logWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
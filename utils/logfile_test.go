@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// files returns the names of the files in dir
+func files(t *testing.T, dir string) []string {
+	list, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fi := range list {
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// gunzip returns the uncompressed content of name
+func gunzip(t *testing.T, name string) string {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func write(t *testing.T, w *logWriter, lines ...string) {
+	for _, s := range lines {
+		if _, err := w.Write([]byte(s + "\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLogWriterRotate(t *testing.T) {
+	today := time.Now().Format("20060102")
+	yesterday := time.Now().AddDate(0, 0, -1).Format("20060102")
+
+	tests := []struct {
+		name    string
+		maxSize int64
+		// yesterday writes lines to the file of yesterday first
+		yesterday []string
+		lines     []string
+		want      map[string]string
+	}{
+		{
+			name:  "no limit",
+			lines: []string{"one", "two", "three"},
+			want: map[string]string{
+				"test-" + today + ".log": "one\ntwo\nthree\n",
+			},
+		},
+		{
+			name:    "by size",
+			maxSize: 8,
+			lines:   []string{"one", "two", "three", "four"},
+			want: map[string]string{
+				"test-" + today + ".1.log.gz": "one\ntwo\n",
+				"test-" + today + ".2.log.gz": "three\n",
+				"test-" + today + ".log":      "four\n",
+			},
+		},
+		{
+			name:    "line above max size",
+			maxSize: 4,
+			lines:   []string{"too long", "one"},
+			want: map[string]string{
+				"test-" + today + ".1.log.gz": "too long\n",
+				"test-" + today + ".log":      "one\n",
+			},
+		},
+		{
+			name:      "by date",
+			yesterday: []string{"late"},
+			lines:     []string{"early"},
+			want: map[string]string{
+				"test-" + yesterday + ".log.gz": "late\n",
+				"test-" + today + ".log":        "early\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			w, err := openLogWriter("test-", LogRotation{Dir: dir, MaxSize: tt.maxSize})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			if tt.yesterday != nil {
+				// reopen as the file of yesterday, written before midnight
+				w.mu.Lock()
+				w.f.Close()
+				err = w.open(time.Now().AddDate(0, 0, -1))
+				for _, s := range tt.yesterday {
+					if err == nil {
+						_, err = w.f.WriteString(s + "\n")
+					}
+				}
+				w.mu.Unlock()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			write(t, w, tt.lines...)
+			w.cleanup()
+
+			var want []string
+			for name := range tt.want {
+				want = append(want, name)
+			}
+			sort.Strings(want)
+			if got := files(t, dir); strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Fatalf("files %v, want %v", got, want)
+			}
+			for name, content := range tt.want {
+				path := filepath.Join(dir, name)
+				var got string
+				if strings.HasSuffix(name, ".gz") {
+					got = gunzip(t, path)
+				} else {
+					b, err := ioutil.ReadFile(path)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got = string(b)
+				}
+				if got != content {
+					t.Errorf("%s holds %q, want %q", name, got, content)
+				}
+			}
+		})
+	}
+}
+
+func TestLogWriterRetention(t *testing.T) {
+	// rotated files and how many days ago they were last written
+	rotated := map[string]int{
+		"test-20210801.log.gz":   1,
+		"test-20210731.2.log.gz": 2,
+		"test-20210731.1.log.gz": 3,
+		"test-20210730.log.gz":   4,
+	}
+	// files cleanup leaves alone however old they are
+	other := map[string]int{
+		"test-notes.log.gz":  10,
+		"other20210701.log":  10,
+		"other20210701.gz":   10,
+		"test-20210701.json": 10,
+	}
+
+	tests := []struct {
+		name     string
+		maxFiles int
+		maxAge   time.Duration
+		want     []string
+	}{
+		{
+			name: "keeps all",
+			want: []string{"test-20210730.log.gz", "test-20210731.1.log.gz", "test-20210731.2.log.gz", "test-20210801.log.gz"},
+		},
+		{
+			name:     "max files",
+			maxFiles: 2,
+			want:     []string{"test-20210731.2.log.gz", "test-20210801.log.gz"},
+		},
+		{
+			name:   "max age",
+			maxAge: 60 * time.Hour,
+			want:   []string{"test-20210731.2.log.gz", "test-20210801.log.gz"},
+		},
+		{
+			name:     "max files and age",
+			maxFiles: 3,
+			maxAge:   36 * time.Hour,
+			want:     []string{"test-20210801.log.gz"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, m := range []map[string]int{rotated, other} {
+				for name, days := range m {
+					path := filepath.Join(dir, name)
+					if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+						t.Fatal(err)
+					}
+					mod := time.Now().Add(-time.Duration(days)*24*time.Hour + time.Minute)
+					if err := os.Chtimes(path, mod, mod); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			w, err := openLogWriter("test-", LogRotation{Dir: dir, MaxFiles: tt.maxFiles, MaxAge: tt.maxAge})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			w.cleanup()
+
+			want := append([]string{filepath.Base(w.Name())}, tt.want...)
+			for name := range other {
+				want = append(want, name)
+			}
+			sort.Strings(want)
+			if got := files(t, dir); strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("files %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -9,7 +9,8 @@ import (
 	"os/exec"
 	"strconv"
 	"strings"
-	"time"
+
+	"github.com/slicken/arbitrager/logger"
 )
 
 // Round helper for RoundPlus
@@ -43,21 +44,51 @@ func TypeName(v interface{}) string {
 	return fmt.Sprintf("%T", v)[6:]
 }
 
-// LogToFile ...
-func LogToFile(tag string) {
+var logFile *logWriter
+
+// LogToFile appends the log to a daily file of tag, which is rotated by r
+func LogToFile(tag string, r LogRotation) {
 	if tag != "" {
 		tag = tag + "_"
 	}
-	logName := tag + time.Now().Format("20060102") + ".log"
-	logFile, err := os.Create(logName)
+	f, err := openLogWriter(tag, r)
 	if err != nil {
-		log.Fatalf("could not create %q: %v", logFile.Name(), err)
+		log.Fatalf("could not open log file: %v", err)
 	}
-	log.SetOutput(io.MultiWriter(os.Stderr, logFile))
+	logFile = f
+	logger.SetOutput(io.MultiWriter(os.Stderr, logFile))
 	log.Printf("logging to %q\n", logFile.Name())
 }
 
-func cls() {
+// LogOnlyToFile stops logging to stderr, the log file keeps everything
+func LogOnlyToFile() {
+	if logFile == nil {
+		return
+	}
+	logger.SetOutput(logFile)
+}
+
+// LogToStderr logs to stderr and the log file again
+func LogToStderr() {
+	if logFile == nil {
+		return
+	}
+	logger.SetOutput(io.MultiWriter(os.Stderr, logFile))
+}
+
+// CloseLog flushes and closes the log file
+func CloseLog() {
+	if logFile == nil {
+		return
+	}
+	logger.SetOutput(os.Stderr)
+	logFile.Sync()
+	logFile.Close()
+	logFile = nil
+}
+
+// Cls clears the terminal
+func Cls() {
 	cls := exec.Command("clear")
 	cls.Stdout = os.Stdout
 	cls.Run()